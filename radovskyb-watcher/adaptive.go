@@ -0,0 +1,68 @@
+package watcher
+
+import "time"
+
+// AdaptiveInterval configures the sleep between two scans, see
+// SetAdaptiveInterval.
+type AdaptiveInterval struct {
+	// Min is the sleep after a scan finding changes, the duration of Start is
+	// used if it is not greater than 0.
+	Min time.Duration
+	// Max is the longest sleep while idle, the sleep does not back off from
+	// Min if it is not greater than 0, MaxScanFraction still applies.
+	Max time.Duration
+	// MaxScanFraction is the largest fraction of the wall time the scans may
+	// take, e.g. 0.1 sleeps at least 9 times the duration of a scan, even if it
+	// is longer than Max. 0 means no limit.
+	MaxScanFraction float64
+}
+
+// SetAdaptiveInterval sets the watcher to sleep Min after a scan finding
+// changes, and to double the sleep after each idle scan up to Max.
+func (w *Watcher) SetAdaptiveInterval(cfg AdaptiveInterval) {
+	w.mu.Lock()
+	w.adaptive = cfg
+	w.mu.Unlock()
+}
+
+// scheduler decides the sleep between two scans of the polling cycle.
+type scheduler struct {
+	cfg      AdaptiveInterval
+	interval time.Duration // the sleep of the last idle scan.
+}
+
+// newScheduler returns the scheduler of cfg, d is the duration of Start.
+func newScheduler(cfg AdaptiveInterval, d time.Duration) *scheduler {
+
+	if cfg.Min <= 0 {
+		cfg.Min = d
+	}
+	if cfg.Max > 0 && cfg.Max < cfg.Min {
+		cfg.Max = cfg.Min
+	}
+	return &scheduler{cfg: cfg, interval: cfg.Min}
+}
+
+// next returns the sleep after a scan taking scanTime, isActive is true if the
+// scan found changes.
+func (s *scheduler) next(scanTime time.Duration, isActive bool) (sleep time.Duration) {
+
+	switch {
+	case s.cfg.Max <= 0:
+	case isActive:
+		s.interval = s.cfg.Min
+	case s.interval < s.cfg.Max:
+		s.interval = min(2*s.interval, s.cfg.Max)
+	}
+	return max(s.interval, s.budget(scanTime))
+}
+
+// budget returns the shortest sleep after a scan taking scanTime which keeps
+// the scans in MaxScanFraction of the wall time, 0 if there is no limit.
+func (s *scheduler) budget(scanTime time.Duration) time.Duration {
+
+	if f := s.cfg.MaxScanFraction; f > 0 && f < 1 {
+		return time.Duration(float64(scanTime) * (1 - f) / f)
+	}
+	return 0
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package watcher
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID identifies a file by its device and inode number.
+type fileID struct {
+	dev, ino uint64
+}
+
+// inodeOf returns the device and inode number of info, ino is 0 if it is
+// unknown.
+func inodeOf(info os.FileInfo) (dev, ino uint64) {
+
+	if fi, ok := info.(*fileInfo); ok {
+		return fi.dev, fi.ino
+	}
+	if sys, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(sys.Dev), uint64(sys.Ino)
+	}
+	return 0, 0
+}
+
+// fileIDOf returns the id of info, isKnown is false if info has no inode
+// number.
+func fileIDOf(info os.FileInfo) (id fileID, isKnown bool) {
+
+	id.dev, id.ino = inodeOf(info)
+	return id, id.ino != 0
+}
@@ -0,0 +1,29 @@
+//go:build !unix
+
+package watcher
+
+import "os"
+
+// fileID identifies a file by its metadata. The file index is not in the
+// os.FileInfo of a listing on this platform, so a file is paired with another
+// one of the same modification time, size and mode.
+type fileID struct {
+	modTime int64
+	size    int64
+	mode    os.FileMode
+}
+
+// inodeOf returns the device and inode number of a file loaded by
+// LoadSnapshot, they are unknown for the files scanned on this platform.
+func inodeOf(info os.FileInfo) (dev, ino uint64) {
+
+	if fi, ok := info.(*fileInfo); ok {
+		return fi.dev, fi.ino
+	}
+	return 0, 0
+}
+
+// fileIDOf returns the id of info, it is always known.
+func fileIDOf(info os.FileInfo) (id fileID, isKnown bool) {
+	return fileID{modTime: info.ModTime().UnixNano(), size: info.Size(), mode: info.Mode()}, true
+}
@@ -0,0 +1,115 @@
+package watcher
+
+import (
+	"bytes"
+	"hash"
+	"io"
+	"os"
+)
+
+// HashConfig configures comparing the content of the files by a hash, see
+// SetHash.
+type HashConfig struct {
+	// New returns the hash computing the sum of a file, e.g. sha256.New. The
+	// content is not compared if New is nil.
+	New func() hash.Hash
+	// MaxSize is the size above which a file is compared by the modification
+	// time and the size only, 0 means no limit.
+	MaxSize int64
+	// OnlyIfMetadataChanged hashes a file only if its modification time or
+	// size changed, so the unchanged files are not read, but a write keeping
+	// both of them is missed.
+	OnlyIfMetadataChanged bool
+}
+
+// SetHash compares the content of the regular files by the hash of cfg. A
+// Write is sent only if the sum of a file changed, so a file touched without
+// changing its content is not reported, and a write keeping the size within
+// the granularity of the modification time is found. A file which can not be
+// read is compared by the modification time and the size.
+func (w *Watcher) SetHash(cfg HashConfig) {
+	w.mu.Lock()
+	w.hash = cfg
+	w.mu.Unlock()
+}
+
+// Hash returns the sum of the file of the event set by SetHash, it is nil if
+// the file is not hashed.
+func (e Event) Hash() []byte { return hashOf(e.FileInfo) }
+
+// hashedFileInfo is a scanned os.FileInfo with the sum of the file.
+type hashedFileInfo struct {
+	os.FileInfo
+	sum []byte
+}
+
+// hashOf returns the sum of info, nil if it is not hashed.
+func hashOf(info os.FileInfo) []byte {
+
+	switch fi := info.(type) {
+	case *hashedFileInfo:
+		return fi.sum
+	case *fileInfo:
+		return fi.sum
+	}
+	return nil
+}
+
+// isMetadataChanged reports whether the modification time or the size of a
+// file changed.
+func isMetadataChanged(oldInfo, info os.FileInfo) bool {
+	return !oldInfo.ModTime().Equal(info.ModTime()) || oldInfo.Size() != info.Size()
+}
+
+// isWritten reports whether a file is written, by the sums if both of them are
+// known, or by the modification time and the size.
+func isWritten(oldInfo, info os.FileInfo) bool {
+
+	if oldSum, sum := hashOf(oldInfo), hashOf(info); oldSum != nil && sum != nil {
+		return !bytes.Equal(oldSum, sum)
+	}
+	return isMetadataChanged(oldInfo, info)
+}
+
+// hashFiles sets the sums of the regular files of fileList by the hash set by
+// SetHash, prev is the files of the last scan. It reads the files without
+// holding w.mu.
+func (w *Watcher) hashFiles(prev, fileList map[string]os.FileInfo) {
+
+	w.mu.Lock()
+	var cfg = w.hash
+	w.mu.Unlock()
+	if cfg.New == nil {
+		return
+	}
+	for path, info := range fileList {
+		if !info.Mode().IsRegular() || (cfg.MaxSize > 0 && info.Size() > cfg.MaxSize) {
+			continue
+		}
+		var oldInfo = prev[path]
+		if cfg.OnlyIfMetadataChanged && oldInfo != nil && !isMetadataChanged(oldInfo, info) {
+			if sum := hashOf(oldInfo); sum != nil {
+				fileList[path] = &hashedFileInfo{FileInfo: info, sum: sum}
+			}
+			continue
+		}
+		if sum, err := hashFile(cfg.New(), path); err == nil {
+			fileList[path] = &hashedFileInfo{FileInfo: info, sum: sum}
+		}
+	}
+}
+
+// hashFile returns the sum of the content of path by h.
+func hashFile(h hash.Hash, path string) (sum []byte, err error) {
+
+	var f *os.File
+	if f, err = os.Open(path); err != nil {
+		return
+	}
+	defer f.Close()
+	if _, err = io.Copy(h, f); err != nil {
+		return
+	}
+	sum = h.Sum(nil)
+	return
+}
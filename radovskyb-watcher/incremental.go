@@ -0,0 +1,134 @@
+package watcher
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// ScanStats counts the work of the scans in the incremental mode, see
+// SetIncrementalScan.
+type ScanStats struct {
+	Scans       uint64 // scans run.
+	FullScans   uint64 // scans listing every directory.
+	DirsListed  uint64 // directories whose entries are stated.
+	DirsSkipped uint64 // unchanged directories whose files are taken from the last scan.
+	StatsSaved  uint64 // files taken from the last scan without stating them.
+}
+
+// SetIncrementalScan sets the watcher to scan incrementally if
+// fullScanInterval is greater than 0. A directory whose modification time and
+// entry count are the same as the last scan is not listed again: its files are
+// taken from the last scan without stating them, only its subdirectories are
+// stated to find the changes below them. A write or a chmod of a file does not
+// change its directory, so it is found by the next full scan, which lists
+// every directory once every fullScanInterval.
+func (w *Watcher) SetIncrementalScan(fullScanInterval time.Duration) {
+	w.mu.Lock()
+	w.fullScanInterval = fullScanInterval
+	w.mu.Unlock()
+}
+
+// Stats returns the counters of the scans in the incremental mode.
+func (w *Watcher) Stats() (stats ScanStats) {
+	w.mu.Lock()
+	stats = w.stats
+	w.mu.Unlock()
+	return
+}
+
+// incrementalScan is the state of a scan in the incremental mode, it is
+// shared by the walkers.
+type incrementalScan struct {
+	w          *Watcher
+	isFull     bool
+	lastCounts map[string]int // entry counts of the directories of the last scan, read only.
+	// mu protects counts and stats.
+	mu     *sync.Mutex
+	counts map[string]int // entry counts of the directories scanned.
+	stats  ScanStats
+}
+
+// beginScan returns the state of a scan, nil if the incremental mode is not
+// set. w.mu must be held.
+func (w *Watcher) beginScan() (scan *incrementalScan) {
+
+	if w.fullScanInterval <= 0 {
+		return
+	}
+	scan = &incrementalScan{
+		w:          w,
+		lastCounts: w.dirCounts,
+		mu:         new(sync.Mutex),
+		counts:     make(map[string]int, len(w.dirCounts)),
+	}
+	if now := time.Now(); now.Sub(w.lastFullScan) >= w.fullScanInterval {
+		scan.isFull, w.lastFullScan = true, now
+		w.stats.FullScans++
+	}
+	w.stats.Scans++
+	return
+}
+
+// endScan keeps the entry counts of scan for the next scan, the directories
+// of the skipped names keep their counts of the last scan. w.mu must be held.
+func (w *Watcher) endScan(scan *incrementalScan, skipped map[string]bool) {
+
+	if scan == nil {
+		return
+	}
+	for dir, count := range scan.lastCounts {
+		if _, found := scan.counts[dir]; !found && isBelowNames(dir, skipped) {
+			scan.counts[dir] = count
+		}
+	}
+	w.dirCounts = scan.counts
+	w.stats.DirsListed += scan.stats.DirsListed
+	w.stats.DirsSkipped += scan.stats.DirsSkipped
+	w.stats.StatsSaved += scan.stats.StatsSaved
+}
+
+// isUnchanged keeps the entry count of dir, and reports whether its
+// modification time and entry count are the same as the last scan. It is
+// false if s is nil or full.
+func (s *incrementalScan) isUnchanged(dir string, info os.FileInfo, count int) (isUnchanged bool) {
+
+	if s == nil {
+		return
+	}
+	if oldInfo := s.w.GetWatchedFileInfoByPath(dir); !s.isFull && oldInfo != nil && oldInfo.IsDir() &&
+		oldInfo.ModTime().Equal(info.ModTime()) {
+		var lastCount, found = s.lastCounts[dir]
+		isUnchanged = found && lastCount == count
+	}
+	s.mu.Lock()
+	s.counts[dir] = count
+	if isUnchanged {
+		s.stats.DirsSkipped++
+	} else {
+		s.stats.DirsListed++
+	}
+	s.mu.Unlock()
+	return
+}
+
+// reuse returns the info of the file of path of the last scan if its directory
+// is unchanged, nil if it must be stated. The directories are always stated to
+// find the changes below them. The sum of the last scan is dropped, hashFiles
+// takes it from the previous files again.
+func (s *incrementalScan) reuse(path string, isUnchanged bool) (info os.FileInfo) {
+
+	if s == nil || !isUnchanged {
+		return
+	}
+	if info = s.w.GetWatchedFileInfoByPath(path); info == nil || info.IsDir() {
+		return nil
+	}
+	if hashed, ok := info.(*hashedFileInfo); ok {
+		info = hashed.FileInfo
+	}
+	s.mu.Lock()
+	s.stats.StatsSaved++
+	s.mu.Unlock()
+	return
+}
@@ -0,0 +1,82 @@
+package watcher
+
+import (
+	"os"
+	"time"
+)
+
+// setInterval sets the poll interval of name, 0 means name is scanned by every
+// polling cycle. It wakes the polling cycle to schedule name. w.mu must be
+// held.
+func (w *Watcher) setInterval(name string, interval time.Duration) {
+
+	if interval > 0 {
+		w.intervals[name], w.lastScans[name] = interval, time.Now()
+	} else {
+		delete(w.intervals, name)
+		delete(w.lastScans, name)
+	}
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dueNames splits the names into the names to scan at now and the names
+// skipped until their intervals pass, the names added without an interval are
+// due with the polling cycle, isCycle reports whether it is. w.mu must be held.
+func (w *Watcher) dueNames(now time.Time) (due, skipped map[string]bool, isCycle bool) {
+
+	isCycle = !now.Before(w.cycleDue)
+	due, skipped = make(map[string]bool, len(w.names)), make(map[string]bool, len(w.intervals))
+	for name, recursive := range w.names {
+		var interval, found = w.intervals[name]
+		if (found && now.Sub(w.lastScans[name]) >= interval) || (!found && isCycle) {
+			due[name] = recursive
+		} else {
+			skipped[name] = recursive
+		}
+	}
+	return
+}
+
+// carryFiles adds the files of the skipped names of the last scan to
+// fileList, a path also listed for a due name is taken from fileList only.
+// w.mu must be held.
+func (w *Watcher) carryFiles(fileList map[string]os.FileInfo, due, skipped map[string]bool) {
+
+	for path, info := range w.files {
+		if _, found := fileList[path]; !found && isBelowNames(path, skipped) && !isBelowNames(path, due) {
+			fileList[path] = info
+		}
+	}
+}
+
+// nextScan returns when the next scan starts: the next polling cycle if a name
+// is added without an interval, or when a name added with an interval is due,
+// whichever is first. It is not before notBefore, which keeps the scan time
+// budget.
+func (w *Watcher) nextScan(notBefore time.Time) (next time.Time) {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var hasCycleNames = len(w.names) == 0
+	for name := range w.names {
+		var interval, found = w.intervals[name]
+		if !found {
+			hasCycleNames = true
+			continue
+		}
+		if due := w.lastScans[name].Add(interval); next.IsZero() || due.Before(next) {
+			next = due
+		}
+	}
+	if hasCycleNames && (next.IsZero() || w.cycleDue.Before(next)) {
+		next = w.cycleDue
+	}
+	if next.Before(notBefore) {
+		next = notBefore
+	}
+	return
+}
@@ -0,0 +1,115 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ReportChildMoves sets the watcher to send a move event for every file and
+// directory below a moved directory. Only the move of the directory itself is
+// sent by default.
+func (w *Watcher) ReportChildMoves(report bool) {
+	w.mu.Lock()
+	w.childMoves = report
+	w.mu.Unlock()
+}
+
+// pairMoves pairs the removed and the created paths of the same file, and
+// returns their Rename and Move events. The paired paths are deleted from
+// removes and creates. The creates are indexed by the file id, so pairing is
+// linear, and a moved directory takes the paths below it, which are paired by
+// their relative paths without a lookup of the index.
+func (w *Watcher) pairMoves(removes, creates map[string]os.FileInfo) (events []Event) {
+
+	w.mu.Lock()
+	var childMoves = w.childMoves
+	w.mu.Unlock()
+	var index = make(map[fileID][]string, len(creates))
+	for path, info := range creates {
+		if id, isKnown := fileIDOf(info); isKnown {
+			index[id] = append(index[id], path)
+		}
+	}
+	// A directory is sorted before the paths below it.
+	var removedPaths = make([]string, 0, len(removes))
+	for path := range removes {
+		removedPaths = append(removedPaths, path)
+	}
+	sort.Strings(removedPaths)
+	var movedDirs = make(map[string]string, 2) // old path to new path.
+	for _, path1 := range removedPaths {
+		var info1 = removes[path1]
+		if oldDir, newDir, isMoved := movedAncestor(movedDirs, path1); isMoved {
+			var path2 = filepath.Join(newDir, path1[len(oldDir):])
+			if _, found := creates[path2]; found {
+				delete(removes, path1)
+				delete(creates, path2)
+				if childMoves {
+					events = append(events, moveEvent(path1, path2, info1))
+				}
+				continue
+			}
+		}
+		var path2, found = popCreate(index, creates, info1)
+		if !found {
+			continue
+		}
+		delete(removes, path1)
+		delete(creates, path2)
+		if info1.IsDir() {
+			movedDirs[path1] = path2
+		}
+		events = append(events, moveEvent(path1, path2, info1))
+	}
+	return
+}
+
+// moveEvent returns the Move event of path1 moved to path2, or Rename if they
+// are in the same directory.
+func moveEvent(path1, path2 string, info os.FileInfo) (e Event) {
+
+	e = Event{Move, path2, path1, info}
+	if filepath.Dir(path1) == filepath.Dir(path2) {
+		e.Op = Rename
+	}
+	return
+}
+
+// movedAncestor returns the nearest directory above path which is moved, and
+// its new path.
+func movedAncestor(movedDirs map[string]string, path string) (oldDir, newDir string, isMoved bool) {
+
+	if len(movedDirs) == 0 {
+		return
+	}
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if newDir, isMoved = movedDirs[dir]; isMoved {
+			oldDir = dir
+			return
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return
+		}
+	}
+}
+
+// popCreate returns a created path of the file of info from index and removes
+// it from index.
+func popCreate(index map[fileID][]string, creates map[string]os.FileInfo, info os.FileInfo) (path string, found bool) {
+
+	var id, isKnown = fileIDOf(info)
+	if !isKnown {
+		return
+	}
+	var paths = index[id]
+	for i, candidate := range paths {
+		var created, isCreated = creates[candidate]
+		if !isCreated || created.IsDir() != info.IsDir() || !mayBeRenamed(info, created) {
+			continue
+		}
+		index[id] = append(paths[:i:i], paths[i+1:]...)
+		return candidate, true
+	}
+	return
+}
@@ -0,0 +1,159 @@
+package watcher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SnapshotVersion is the version of the format written by SaveSnapshot.
+const SnapshotVersion = 1
+
+// ErrSnapshotVersion occurs when LoadSnapshot reads a snapshot written in a
+// format it does not know.
+var ErrSnapshotVersion = errors.New("error: unsupported snapshot version")
+
+// snapshot is the on-disk format of the watched names and files.
+type snapshot struct {
+	Version int             `json:"version"`
+	Names   map[string]bool `json:"names"` // bool for recursive or not.
+	Files   []snapshotFile  `json:"files"`
+}
+
+type snapshotFile struct {
+	Path    string      `json:"path"`
+	Size    int64       `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mod_time"`
+	Dev     uint64      `json:"dev,omitempty"`
+	Inode   uint64      `json:"inode,omitempty"`
+	Hash    []byte      `json:"hash,omitempty"` // see SetHash.
+}
+
+// SaveSnapshot writes the watched names and the files of the last scan to
+// path. The file is replaced atomically, so a crash while saving keeps the
+// previous snapshot.
+func (w *Watcher) SaveSnapshot(path string) (err error) {
+
+	var s = snapshot{Version: SnapshotVersion}
+	w.mu.Lock()
+	s.Names = make(map[string]bool, len(w.names))
+	for name, recursive := range w.names {
+		s.Names[name] = recursive
+	}
+	s.Files = make([]snapshotFile, 0, len(w.files))
+	for name, info := range w.files {
+		var dev, ino = inodeOf(info)
+		s.Files = append(s.Files, snapshotFile{
+			Path:    name,
+			Size:    info.Size(),
+			Mode:    info.Mode(),
+			ModTime: info.ModTime(),
+			Dev:     dev,
+			Inode:   ino,
+			Hash:    hashOf(info),
+		})
+	}
+	w.mu.Unlock()
+	sort.Slice(s.Files, func(i, j int) bool { return s.Files[i].Path < s.Files[j].Path })
+	var data []byte
+	if data, err = json.Marshal(s); err != nil {
+		return
+	}
+	var tmp *os.File
+	if tmp, err = os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*"); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadSnapshot reads the snapshot saved by SaveSnapshot at path. It must be
+// called before the names are added: Add and AddRecursive of a name in the
+// snapshot take its files as the last scan, so the first scan reports the
+// changes made while the watcher was not running. A missing file is not an
+// error.
+func (w *Watcher) LoadSnapshot(path string) (err error) {
+
+	var data []byte
+	if data, err = os.ReadFile(path); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	var s snapshot
+	if err = json.Unmarshal(data, &s); err != nil {
+		return
+	}
+	if s.Version != SnapshotVersion {
+		return fmt.Errorf("%w: %d", ErrSnapshotVersion, s.Version)
+	}
+	var files = make(map[string]os.FileInfo, len(s.Files))
+	for _, file := range s.Files {
+		files[file.Path] = &fileInfo{
+			name:    filepath.Base(file.Path),
+			size:    file.Size,
+			mode:    file.Mode,
+			modTime: file.ModTime,
+			dir:     file.Mode.IsDir(),
+			dev:     file.Dev,
+			ino:     file.Inode,
+			sum:     file.Hash,
+		}
+	}
+	w.mu.Lock()
+	w.baselineNames, w.baseline = s.Names, files
+	w.mu.Unlock()
+	return
+}
+
+// takeBaseline returns the files of name loaded by LoadSnapshot, or fileList
+// if name is not in the snapshot or it was watched with another recursive
+// flag. The files taken are removed from the baseline. w.mu must be held.
+func (w *Watcher) takeBaseline(name string, recursive bool, fileList map[string]os.FileInfo) map[string]os.FileInfo {
+
+	if wasRecursive, found := w.baselineNames[name]; !found || wasRecursive != recursive {
+		return fileList
+	}
+	delete(w.baselineNames, name)
+	var prefix = name + string(os.PathSeparator)
+	var files = make(map[string]os.FileInfo, len(fileList))
+	for path, info := range w.baseline {
+		if path == name || strings.HasPrefix(path, prefix) {
+			files[path] = info
+			delete(w.baseline, path)
+		}
+	}
+	return files
+}
+
+// mayBeRenamed reports whether current can be the file of info after a
+// rename. The inode of a removed file may be reused by a new file and the
+// device and inode of a file loaded by LoadSnapshot are all it is known by, so
+// its size and modification time, which a rename keeps, must be the same too.
+func mayBeRenamed(info, current os.FileInfo) bool {
+
+	var fi, ok = info.(*fileInfo)
+	return !ok || (fi.size == current.Size() && fi.modTime.Equal(current.ModTime()))
+}
@@ -0,0 +1,226 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// SetWalkers sets the maximum number of goroutines walking the directories of
+// a name by AddRecursive and each scan, n less than 1 means
+// runtime.GOMAXPROCS(0), which is the default. The filter hooks are called by
+// the walkers concurrently.
+func (w *Watcher) SetWalkers(n int) {
+	w.mu.Lock()
+	w.walkers = n
+	w.mu.Unlock()
+}
+
+// lister lists the paths by a copy of the filters of a watcher, so it runs
+// without holding w.mu.
+type lister struct {
+	ffh          []FilterFileHookFunc
+	ignored      map[string]struct{}
+	ignoreHidden bool
+	walkers      int
+	scan         *incrementalScan // nil if the scan is not incremental.
+}
+
+// newLister returns a lister by the filters of w. w.mu must be held.
+func (w *Watcher) newLister(scan *incrementalScan) (l *lister) {
+
+	l = &lister{
+		ffh:          append([]FilterFileHookFunc(nil), w.ffh...),
+		ignored:      make(map[string]struct{}, len(w.ignored)),
+		ignoreHidden: w.ignoreHidden,
+		walkers:      w.walkers,
+		scan:         scan,
+	}
+	for path := range w.ignored {
+		l.ignored[path] = struct{}{}
+	}
+	if l.walkers < 1 {
+		l.walkers = runtime.GOMAXPROCS(0)
+	}
+	return
+}
+
+// list return file or a dir with dirs and files below it but no recursive
+func (w *Watcher) list(name string) (fileList map[string]os.FileInfo, err error) {
+
+	w.mu.Lock()
+	var l = w.newLister(nil)
+	w.mu.Unlock()
+	return l.walk(name, false)
+}
+
+// listRecursive returns name and the paths below it recursively.
+func (w *Watcher) listRecursive(name string) (fileList map[string]os.FileInfo, err error) {
+
+	w.mu.Lock()
+	var l = w.newLister(nil)
+	w.mu.Unlock()
+	return l.walk(name, true)
+}
+
+// walker walks the directories of a name by at most walkers goroutines.
+type walker struct {
+	*lister
+	recursive bool
+	sem       chan struct{} // the goroutine calling walk is a walker too.
+	wg        *sync.WaitGroup
+	// mu protects fileList and err.
+	mu       *sync.Mutex
+	fileList map[string]os.FileInfo
+	err      error
+}
+
+// walk returns name and the paths below it, recursively if recursive is true,
+// and the first error of the walkers. A hidden or ignored name and the paths
+// filtered by the filter hooks are only skipped if recursive is true, like
+// filepath.Walk.
+func (l *lister) walk(name string, recursive bool) (fileList map[string]os.FileInfo, err error) {
+
+	var stat os.FileInfo
+	if recursive {
+		stat, err = os.Lstat(name)
+	} else {
+		stat, err = os.Stat(name)
+	}
+	if err != nil {
+		return
+	}
+	var wk = &walker{
+		lister:    l,
+		recursive: recursive,
+		sem:       make(chan struct{}, l.walkers-1),
+		wg:        new(sync.WaitGroup),
+		mu:        new(sync.Mutex),
+		fileList:  make(map[string]os.FileInfo, 4),
+	}
+	var isKept, isWalked = true, true
+	if recursive {
+		if isKept, isWalked, err = l.filterPath(name, stat); err != nil {
+			return
+		}
+	}
+	if isKept {
+		wk.fileList[name] = stat
+	}
+	if stat.IsDir() && isWalked {
+		wk.walkDir(name, stat)
+		wk.wg.Wait()
+	}
+	return wk.fileList, wk.err
+}
+
+// walkDir adds the entries of dir, and walks the directories below it if the
+// walk is recursive, by another goroutine if there is a free walker.
+func (wk *walker) walkDir(dir string, info os.FileInfo) {
+
+	var names, err = readDirNames(dir)
+	if err != nil {
+		wk.fail(err)
+		return
+	}
+	var isUnchanged = wk.scan.isUnchanged(dir, info, len(names))
+	for _, name := range names {
+		if wk.failed() {
+			return
+		}
+		var path = filepath.Join(dir, name)
+		var child = wk.scan.reuse(path, isUnchanged)
+		if child == nil {
+			if child, err = os.Lstat(path); err != nil {
+				// the entry is removed after it is read.
+				if os.IsNotExist(err) {
+					continue
+				}
+				wk.fail(err)
+				return
+			}
+		}
+		var isKept, isWalked bool
+		if isKept, isWalked, err = wk.filterPath(path, child); err != nil {
+			wk.fail(err)
+			return
+		}
+		if isKept {
+			wk.mu.Lock()
+			wk.fileList[path] = child
+			wk.mu.Unlock()
+		}
+		if !wk.recursive || !isWalked || !child.IsDir() {
+			continue
+		}
+		select {
+		case wk.sem <- struct{}{}:
+			wk.wg.Add(1)
+			go func(path string, child os.FileInfo) {
+				defer func() {
+					<-wk.sem
+					wk.wg.Done()
+				}()
+				wk.walkDir(path, child)
+			}(path, child)
+		default:
+			wk.walkDir(path, child)
+		}
+	}
+}
+
+// fail keeps the first error of the walkers, the others stop after it.
+func (wk *walker) fail(err error) {
+
+	wk.mu.Lock()
+	if wk.err == nil {
+		wk.err = err
+	}
+	wk.mu.Unlock()
+}
+
+func (wk *walker) failed() (isFailed bool) {
+
+	wk.mu.Lock()
+	isFailed = wk.err != nil
+	wk.mu.Unlock()
+	return
+}
+
+// filterPath filters path like filepath.Walk of the filters: a hidden or
+// ignored path is neither kept nor walked, a path skipped by ErrSkip of a
+// filter hook is not kept but walked, and by filepath.SkipDir neither.
+func (l *lister) filterPath(path string, info os.FileInfo) (isKept, isWalked bool, err error) {
+
+	var isHidden bool
+	if isHidden, err = isHiddenFileEx(path); err != nil {
+		return
+	}
+	if _, ignored := l.ignored[path]; ignored || (isHidden && l.ignoreHidden) {
+		return
+	}
+	for _, f := range l.ffh {
+		switch err = f(info, path); err {
+		case nil:
+		case ErrSkip:
+			return false, true, nil
+		case filepath.SkipDir:
+			return false, false, nil
+		default:
+			return
+		}
+	}
+	return true, true, nil
+}
+
+// readDirNames returns the names of the entries of dir without stating them.
+func readDirNames(dir string) (names []string, err error) {
+
+	var f *os.File
+	if f, err = os.Open(dir); err != nil {
+		return
+	}
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
@@ -90,6 +90,7 @@ func (e Event) String() string {
 
 // FilterFileHookFunc is a function that is called to filter files during listings.
 // If a file is ok to be listed, nil is returned otherwise ErrSkip is returned.
+// For a directory, filepath.SkipDir can be returned to skip it and all files below it.
 type FilterFileHookFunc func(info os.FileInfo, fullPath string) error
 
 // RegexFilterHook is a function that accepts or rejects a file
@@ -119,15 +120,31 @@ type Watcher struct {
 	close  chan struct{}
 	wg     *sync.WaitGroup
 	// mu protects the following.
-	mu           *sync.Mutex
-	ffh          []FilterFileHookFunc
-	names        map[string]bool        // bool for recursive or not.
-	files        map[string]os.FileInfo // map of files.
-	ignored      map[string]struct{}    // ignored files or directories.
-	ops          map[Op]bool            // Op filtering, the ops you will only get. if empty, you can get all ops, if not empty, you will only receive the ops those in this map ops
-	maxEvents    int                    // max sent events per cycle, maxEvents controls the maximum amount of events that are sent on, the Event channel per watching cycle, If max events is less than 1, there is no limit, which is the default.
-	ignoreHidden bool                   // ignore hidden files or not.
-	running      bool
+	mu            *sync.Mutex
+	ffh           []FilterFileHookFunc
+	names         map[string]bool        // bool for recursive or not.
+	files         map[string]os.FileInfo // map of files.
+	ignored       map[string]struct{}    // ignored files or directories.
+	ops           map[Op]bool            // Op filtering, the ops you will only get. if empty, you can get all ops, if not empty, you will only receive the ops those in this map ops
+	maxEvents     int                    // max sent events per cycle, maxEvents controls the maximum amount of events that are sent on, the Event channel per watching cycle, If max events is less than 1, there is no limit, which is the default.
+	ignoreHidden  bool                   // ignore hidden files or not.
+	baseline      map[string]os.FileInfo // files loaded by LoadSnapshot, see takeBaseline.
+	baselineNames map[string]bool        // names loaded by LoadSnapshot, bool for recursive or not.
+	hash          HashConfig             // content comparison, see SetHash.
+	childMoves    bool                   // report the moves below a moved directory, see ReportChildMoves.
+	// incremental scan, see SetIncrementalScan.
+	fullScanInterval time.Duration
+	lastFullScan     time.Time
+	dirCounts        map[string]int // entry counts of the directories of the last scan.
+	stats            ScanStats
+	walkers          int                      // see SetWalkers.
+	adaptive         AdaptiveInterval         // see SetAdaptiveInterval.
+	gen              uint64                   // increased when names or ignored change, see scanFiles.
+	intervals        map[string]time.Duration // poll intervals of the names added with an interval.
+	lastScans        map[string]time.Time     // last scans of the names added with an interval.
+	cycleDue         time.Time                // next scan of the names added without an interval.
+	wake             chan struct{}            // wakes the polling cycle after a name is added.
+	running          bool
 }
 
 // New creates a new Watcher.
@@ -137,16 +154,19 @@ func New() *Watcher {
 	var wg sync.WaitGroup
 	wg.Add(1)
 	return &Watcher{
-		Event:   make(chan Event),
-		Error:   make(chan error),
-		Closed:  make(chan struct{}),
-		close:   make(chan struct{}),
-		wg:      &wg,
-		ffh:     make([]FilterFileHookFunc, 0, 2),
-		mu:      new(sync.Mutex),
-		names:   make(map[string]bool, 4),
-		files:   make(map[string]os.FileInfo, 8),
-		ignored: make(map[string]struct{}, 2),
+		Event:     make(chan Event),
+		Error:     make(chan error),
+		Closed:    make(chan struct{}),
+		close:     make(chan struct{}),
+		wg:        &wg,
+		ffh:       make([]FilterFileHookFunc, 0, 2),
+		mu:        new(sync.Mutex),
+		names:     make(map[string]bool, 4),
+		files:     make(map[string]os.FileInfo, 8),
+		ignored:   make(map[string]struct{}, 2),
+		intervals: make(map[string]time.Duration, 1),
+		lastScans: make(map[string]time.Time, 1),
+		wake:      make(chan struct{}, 1),
 	}
 }
 
@@ -166,7 +186,8 @@ func (w *Watcher) IsGreaterThanMaxEvents(numEvents int) (isGt bool) {
 	return
 }
 
-// AddFilterHook
+// AddFilterHook adds a filter hook called for every path listed, it may be
+// called by the walkers concurrently, see SetWalkers.
 func (w *Watcher) AddFilterHook(f FilterFileHookFunc) {
 	w.mu.Lock()
 	w.ffh = append(w.ffh, f)
@@ -201,150 +222,77 @@ func (w *Watcher) IsOpSkipByFilterOps(inOp Op) (skip bool) {
 
 // Add adds either a single file or directory to the file list.
 func (w *Watcher) Add(name string) (err error) {
+	return w.AddWithInterval(name, 0)
+}
 
-	w.mu.Lock()
-	defer w.mu.Unlock()
+// AddWithInterval adds either a single file or directory to the file list,
+// it is scanned every interval instead of by every polling cycle if interval
+// is greater than 0.
+func (w *Watcher) AddWithInterval(name string, interval time.Duration) (err error) {
 
 	if name, err = filepath.Abs(name); err != nil {
 		return
 	}
+	w.mu.Lock()
+	var l = w.newLister(nil)
+	w.mu.Unlock()
 	// If name is on the ignored list or if hidden files are
 	// ignored and name is a hidden file or directory, simply return.
 	var isHidden bool
 	if isHidden, err = isHiddenFileEx(name); err != nil {
 		return
 	}
-	if _, ignored := w.ignored[name]; ignored || (isHidden && w.ignoreHidden) {
+	if _, ignored := l.ignored[name]; ignored || (isHidden && l.ignoreHidden) {
 		return
 	}
-	// Add the directory's contents to the files list.
+	// Add the directory's contents to the files list, it is listed without
+	// holding the lock.
 	var fileList map[string]os.FileInfo
-	if fileList, err = w.list(name); err != nil {
+	if fileList, err = l.walk(name, false); err != nil {
 		return
 	}
-	for k, v := range fileList {
+	w.mu.Lock()
+	for k, v := range w.takeBaseline(name, false, fileList) {
 		w.files[k] = v
 	}
 	// Add the name to the names list.
 	w.names[name] = false
-	return
-}
-
-// list return file or a dir with dirs and files below it but no recursive
-func (w *Watcher) list(name string) (fileList map[string]os.FileInfo, err error) {
-
-	// Make sure name exists.
-	var stat os.FileInfo
-	if stat, err = os.Stat(name); err != nil {
-		return
-	}
-	fileList = make(map[string]os.FileInfo, 4)
-	fileList[name] = stat
-	// If it's not a directory, just return.
-	if !stat.IsDir() {
-		return
-	}
-	// It's a directory.
-	var entries []fs.DirEntry
-	if entries, err = os.ReadDir(name); err != nil {
-		return
-	}
-	var fInfo fs.FileInfo
-	var fInfoList = make([]fs.FileInfo, 0, len(entries))
-	for _, entry := range entries {
-		if fInfo, err = entry.Info(); err != nil {
-			return
-		}
-		fInfoList = append(fInfoList, fInfo)
-	}
-	// Add all of the files in the directory to the file list as long
-	// as they aren't on the ignored list or are hidden files if ignoreHidden
-	// is set to true.
-	var path string
-	var isHidden bool
-outer:
-	for _, fInfo = range fInfoList {
-		path = filepath.Join(name, fInfo.Name())
-		if isHidden, err = isHiddenFileEx(path); err != nil {
-			return
-		}
-		if _, ignored := w.ignored[path]; ignored || (isHidden && w.ignoreHidden) {
-			continue
-		}
-		for _, f := range w.ffh {
-			switch err = f(fInfo, path); err {
-			case nil:
-			case ErrSkip:
-				err = nil
-				continue outer
-			default:
-				return
-			}
-		}
-		fileList[path] = fInfo
-	}
+	w.setInterval(name, interval)
+	w.gen++
+	w.mu.Unlock()
 	return
 }
 
 // AddRecursive adds either a single file or directory recursively to the file list.
 func (w *Watcher) AddRecursive(name string) (err error) {
+	return w.AddRecursiveWithInterval(name, 0)
+}
 
-	w.mu.Lock()
-	defer w.mu.Unlock()
+// AddRecursiveWithInterval adds either a single file or directory recursively
+// to the file list, it is scanned every interval instead of by every polling
+// cycle if interval is greater than 0.
+func (w *Watcher) AddRecursiveWithInterval(name string, interval time.Duration) (err error) {
 
 	if name, err = filepath.Abs(name); err != nil {
 		return
 	}
+	// The tree is walked without holding the lock.
 	var fileList map[string]os.FileInfo
 	if fileList, err = w.listRecursive(name); err != nil {
 		return
 	}
-	for k, v := range fileList {
+	w.mu.Lock()
+	for k, v := range w.takeBaseline(name, true, fileList) {
 		w.files[k] = v
 	}
 	// Add the name to the names list.
 	w.names[name] = true
+	w.setInterval(name, interval)
+	w.gen++
+	w.mu.Unlock()
 	return
 }
 
-func (w *Watcher) listRecursive(name string) (fileList map[string]os.FileInfo, err error) {
-
-	fileList = make(map[string]fs.FileInfo, 4)
-	return fileList, filepath.Walk(name, func(path string, info os.FileInfo, inErr error) (err error) {
-		if inErr != nil {
-			err = inErr
-			return
-		}
-		// If path is ignored and it's a directory, skip the directory. If it's
-		// ignored and it's a single file, skip the file.
-		var isHidden bool
-		if isHidden, err = isHiddenFileEx(path); err != nil {
-			return
-		}
-		if _, ignored := w.ignored[path]; ignored || (isHidden && w.ignoreHidden) {
-			if info.IsDir() {
-				err = filepath.SkipDir
-			}
-			return
-		}
-		// callbacks after skip ignored files
-		for _, f := range w.ffh {
-			switch err = f(info, path); err {
-			case nil:
-			case ErrSkip:
-				err = nil
-				return
-			default:
-				return
-			}
-		}
-		// Add the path and it's info to the file list.
-		// notice: if a dir skipped by w.ffh but the files below it do not, the files will add into this fileLists
-		fileList[path] = info
-		return
-	})
-}
-
 // Remove removes either a single file or directory from the file's list.
 func (w *Watcher) Remove(name string) (err error) {
 
@@ -362,6 +310,9 @@ func (w *Watcher) remove(name string) (err error) {
 	}
 	// Remove the name from w's names list.
 	delete(w.names, name)
+	delete(w.intervals, name)
+	delete(w.lastScans, name)
+	w.gen++
 	// If name is a single file, remove it and return.
 	var info, found = w.files[name]
 	if !found {
@@ -397,6 +348,9 @@ func (w *Watcher) removeRecursive(name string) (err error) {
 	}
 	// Remove the name from w's names list.
 	delete(w.names, name)
+	delete(w.intervals, name)
+	delete(w.lastScans, name)
+	w.gen++
 	// If name is a single file, remove it and return.
 	var info, found = w.files[name]
 	if !found {
@@ -429,6 +383,7 @@ func (w *Watcher) Ignore(paths ...string) (err error) {
 		}
 		w.mu.Lock()
 		w.ignored[path] = struct{}{}
+		w.gen++
 		w.mu.Unlock()
 	}
 	return nil
@@ -446,6 +401,18 @@ func (w *Watcher) WatchedFiles() (files map[string]os.FileInfo) {
 	return
 }
 
+// WatchedNames returns a map of names added by Add and AddRecursive, bool for recursive or not.
+func (w *Watcher) WatchedNames() (names map[string]bool) {
+
+	w.mu.Lock()
+	names = make(map[string]bool, len(w.names))
+	for k, v := range w.names {
+		names[k] = v
+	}
+	w.mu.Unlock()
+	return
+}
+
 func (w *Watcher) GetWatchedFileInfoByPath(path string) (fileInfo os.FileInfo) {
 
 	w.mu.Lock()
@@ -464,6 +431,9 @@ type fileInfo struct {
 	modTime time.Time
 	sys     interface{}
 	dir     bool
+	dev     uint64 // device of a file loaded by LoadSnapshot.
+	ino     uint64 // inode number of a file loaded by LoadSnapshot.
+	sum     []byte // sum of a file loaded by LoadSnapshot, see SetHash.
 }
 
 func (fs *fileInfo) IsDir() bool        { return fs.dir }
@@ -484,50 +454,146 @@ func (w *Watcher) TriggerEvent(eventType Op, file os.FileInfo) {
 	w.Event <- Event{Op: eventType, Path: "-", FileInfo: file}
 }
 
+// listing is the result of a scan by scanFiles.
+type listing struct {
+	files map[string]os.FileInfo // files of names.
+	prev  map[string]os.FileInfo // copy of w.files when the scan ends.
+	names map[string]bool        // names of w when the scan ends.
+	gen   uint64                 // w.gen when the scan ends.
+	// isCycle reports whether the names added without an interval are
+	// scanned.
+	isCycle bool
+}
+
+// retrieveFileList returns the files of the watched names.
 func (w *Watcher) retrieveFileList() (fileList map[string]os.FileInfo) {
+	return w.scanFiles().files
+}
+
+// scanFiles lists the watched names without holding the lock. The names added
+// or removed, and the paths ignored, while listing are patched into the files
+// by patchFiles.
+func (w *Watcher) scanFiles() (l listing) {
 
 	w.mu.Lock()
-	defer w.mu.Unlock()
+	var gen, now = w.gen, time.Now()
+	var names = make(map[string]bool, len(w.names))
+	for name, recursive := range w.names {
+		names[name] = recursive
+	}
+	var due, skipped, isCycle = w.dueNames(now)
+	var lister = w.newLister(w.beginScan())
+	w.mu.Unlock()
 
-	fileList = make(map[string]os.FileInfo, 4)
+	l.files = make(map[string]os.FileInfo, 4)
+	var deleted = make(map[string]bool, 1) // bool for recursive or not.
 	var list map[string]os.FileInfo
 	var err error
-	for name, recursive := range w.names {
-		if recursive {
-			if list, err = w.listRecursive(name); err != nil {
-				if os.IsNotExist(err) {
-					// panic: interface conversion: error is syscall.Errno, not *fs.PathError
-					if pathError, ok := err.(*os.PathError); ok && pathError.Path == name {
-						w.Error <- ErrWatchedFileDeleted
-						w.removeRecursive(name)
-					}
-				} else {
-					w.Error <- err
-				}
-			}
-		} else {
-			if list, err = w.list(name); err != nil {
-				if os.IsNotExist(err) {
-					// panic: interface conversion: error is syscall.Errno, not *fs.PathError
-					if pathError, ok := err.(*os.PathError); ok && pathError.Path == name {
-						w.Error <- ErrWatchedFileDeleted
-						w.remove(name)
-					}
-				} else {
-					w.Error <- err
+	for name, recursive := range due {
+		if list, err = lister.walk(name, recursive); err != nil {
+			if os.IsNotExist(err) {
+				// panic: interface conversion: error is syscall.Errno, not *fs.PathError
+				if pathError, ok := err.(*os.PathError); ok && pathError.Path == name {
+					deleted[name] = recursive
 				}
+			} else {
+				w.Error <- err
 			}
 		}
 		// Add the file's to the file list.
 		for k, v := range list {
-			fileList[k] = v
+			l.files[k] = v
 		}
 	}
+
+	w.mu.Lock()
+	w.endScan(lister.scan, skipped)
+	// The skipped names keep their files of the last scan.
+	if len(skipped) > 0 {
+		w.carryFiles(l.files, due, skipped)
+	}
+	if w.gen != gen {
+		w.patchFiles(l.files, names)
+	}
+	for name := range due {
+		if _, found := w.lastScans[name]; found {
+			w.lastScans[name] = now
+		}
+	}
+	for name, recursive := range deleted {
+		if recursive {
+			w.removeRecursive(name)
+		} else {
+			w.remove(name)
+		}
+	}
+	l.prev = make(map[string]os.FileInfo, len(w.files))
+	for k, v := range w.files {
+		l.prev[k] = v
+	}
+	l.names = make(map[string]bool, len(w.names))
+	for name, recursive := range w.names {
+		l.names[name] = recursive
+	}
+	l.gen, l.isCycle = w.gen, isCycle
+	w.mu.Unlock()
+	for range deleted {
+		w.Error <- ErrWatchedFileDeleted
+	}
 	return
 }
 
+// patchFiles makes fileList, listed for names, the files of w.names: the files
+// of the names added since are taken from w.files, and the files of the names
+// removed or below the paths ignored since are deleted. w.mu must be held.
+func (w *Watcher) patchFiles(fileList map[string]os.FileInfo, names map[string]bool) {
+
+	for path, info := range w.files {
+		if !isBelowNames(path, names) {
+			fileList[path] = info
+		}
+	}
+	for path := range fileList {
+		if !isBelowNames(path, w.names) || w.isIgnoredPath(path) {
+			delete(fileList, path)
+		}
+	}
+}
+
+// isBelowNames reports whether path is listed for one of names, which is the
+// name itself, a path directly below it, or below it if it is recursive.
+func isBelowNames(path string, names map[string]bool) bool {
+
+	if _, found := names[path]; found {
+		return true
+	}
+	for dir, isParent := filepath.Dir(path), true; ; dir, isParent = filepath.Dir(dir), false {
+		if recursive, found := names[dir]; found && (recursive || isParent) {
+			return true
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return false
+		}
+	}
+}
+
+// isIgnoredPath reports whether path or a directory above it is ignored. w.mu
+// must be held.
+func (w *Watcher) isIgnoredPath(path string) bool {
+
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if _, ignored := w.ignored[dir]; ignored {
+			return true
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return false
+		}
+	}
+}
+
 // Start begins the polling cycle which repeats every specified
-// duration until Close is called.
+// duration until Close is called, or by an adaptive interval, see
+// SetAdaptiveInterval.
 func (w *Watcher) Start(d time.Duration) (err error) {
 
 	// Return an error if d is less than 1 nanosecond.
@@ -543,23 +609,27 @@ func (w *Watcher) Start(d time.Duration) (err error) {
 		return
 	}
 	w.running = true
+	var sched = newScheduler(w.adaptive, d)
 	w.mu.Unlock()
 	// Unblock w.Wait().
 	w.wg.Done()
 	for {
 		// done lets the inner polling cycle loop know when the
 		// current cycle's method has finished executing.
-		var done = make(chan struct{})
+		var done = make(chan struct{}, 1)
 		// Any events that are found are first piped to evt before
 		// being sent to the main Event channel.
 		var evt = make(chan Event)
 		// Retrieve the file list for all watched file's and dirs.
-		var fileList = w.retrieveFileList()
+		var scanStart = time.Now()
+		var l = w.scanFiles()
+		w.hashFiles(l.prev, l.files)
+		var scanTime = time.Since(scanStart)
 		// cancel can be used to cancel the current event polling function.
 		var cancel = make(chan struct{})
 		// Look for events.
 		go func() {
-			w.pollEvents(fileList, evt, cancel)
+			w.pollEvents(l.prev, l.files, evt, cancel)
 			done <- struct{}{}
 		}()
 		// numEvents holds the number of events for the current cycle.
@@ -587,16 +657,42 @@ func (w *Watcher) Start(d time.Duration) (err error) {
 			}
 		}
 
-		// Update the file's list.
+		// Update the file's list, the names changed while polling keep
+		// their files.
 		w.mu.Lock()
-		w.files = fileList
+		if w.gen != l.gen {
+			w.patchFiles(l.files, l.names)
+		}
+		w.files = l.files
 		w.mu.Unlock()
-		// Sleep and then continue to the next loop iteration.
-		time.Sleep(d)
+		// The names added without an interval are scanned again after the
+		// sleep of the cycle, the others by their intervals.
+		var now = time.Now()
+		if l.isCycle {
+			w.mu.Lock()
+			w.cycleDue = now.Add(sched.next(scanTime, numEvents > 0))
+			w.mu.Unlock()
+		}
+		// Sleep and then continue to the next loop iteration, the sleep is
+		// ended by Close, and computed again when a name is added.
+		for isSleeping := true; isSleeping; {
+			var timer = time.NewTimer(time.Until(w.nextScan(now.Add(sched.budget(scanTime)))))
+			select {
+			case <-w.close:
+				timer.Stop()
+				close(w.Closed)
+				return
+			case <-w.wake:
+				timer.Stop()
+			case <-timer.C:
+				isSleeping = false
+			}
+		}
 	}
 }
 
-func (w *Watcher) pollEvents(files map[string]os.FileInfo, evt chan Event, cancel chan struct{}) {
+// pollEvents sends the events of the changes from prev to files.
+func (w *Watcher) pollEvents(prev, files map[string]os.FileInfo, evt chan Event, cancel chan struct{}) {
 
 	// Store create and remove events for use to check for rename events.
 	var (
@@ -604,7 +700,7 @@ func (w *Watcher) pollEvents(files map[string]os.FileInfo, evt chan Event, cance
 		removes = make(map[string]os.FileInfo, len(files))
 	)
 	// Check for removed files.
-	for path, info := range w.WatchedFiles() {
+	for path, info := range prev {
 		if files[path] == nil {
 			removes[path] = info
 		}
@@ -612,13 +708,13 @@ func (w *Watcher) pollEvents(files map[string]os.FileInfo, evt chan Event, cance
 	// Check for created files, writes and chmods.
 	var oldInfo os.FileInfo
 	for path, info := range files {
-		if oldInfo = w.GetWatchedFileInfoByPath(path); oldInfo == nil { // A file was created.
+		if oldInfo = prev[path]; oldInfo == nil { // A file was created.
 			// first scan, if file renames, will send removed event, second scan, file wrote by created, will only send created event, if time of rename and write is more than time of one scan. so it will not send write event. should we send write event when create, or just setting a bigger sleep gap between two scan?
 			// now we send write event when create if file size > 0. see the code below when create events are sended
 			creates[path] = info
 			continue
 		}
-		if oldInfo.ModTime() != info.ModTime() || oldInfo.Size() != info.Size() {
+		if isWritten(oldInfo, info) {
 			select {
 			case <-cancel:
 				return
@@ -634,23 +730,11 @@ func (w *Watcher) pollEvents(files map[string]os.FileInfo, evt chan Event, cance
 		}
 	}
 	// Check for renames and moves.
-	for path1, info1 := range removes {
-		for path2, info2 := range creates {
-			if sameFile(info1, info2) {
-				var e = Event{Move, path2, path1, info1}
-				// If they are from the same directory, it's a rename
-				// instead of a move event.
-				if filepath.Dir(path1) == filepath.Dir(path2) {
-					e.Op = Rename
-				}
-				delete(removes, path1)
-				delete(creates, path2)
-				select {
-				case <-cancel:
-					return
-				case evt <- e:
-				}
-			}
+	for _, e := range w.pairMoves(removes, creates) {
+		select {
+		case <-cancel:
+			return
+		case evt <- e:
 		}
 	}
 	// Send all the remaining create and remove events.
@@ -692,6 +776,11 @@ func (w *Watcher) Close() {
 	w.running = false
 	w.files = make(map[string]os.FileInfo)
 	w.names = make(map[string]bool)
+	w.baseline, w.baselineNames = nil, nil
+	w.dirCounts = nil
+	w.intervals = make(map[string]time.Duration)
+	w.lastScans = make(map[string]time.Time)
+	w.cycleDue = time.Time{}
 	w.mu.Unlock()
 	// Send a close signal to the Start method.
 	w.close <- struct{}{}
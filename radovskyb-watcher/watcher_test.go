@@ -1,6 +1,10 @@
 package watcher
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -1009,3 +1013,572 @@ func TestOpsString(t *testing.T) {
 		}
 	}
 }
+
+func TestSnapshot(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	snapshotPath := filepath.Join(t.TempDir(), "snapshot.json")
+
+	w := New()
+	if err := w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SaveSnapshot(snapshotPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Change the files while no watcher is running.
+	if err := os.WriteFile(filepath.Join(testDir, "file_1.txt"), []byte("hello"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// new.txt is created first, so it does not reuse the inode of file_2.txt.
+	if err := os.WriteFile(filepath.Join(testDir, "new.txt"), []byte{}, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(testDir, "file_2.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(testDir, "file_3.txt"), filepath.Join(testDir, "file_4.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	w = New()
+	if err := w.LoadSnapshot(snapshotPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := w.Start(time.Millisecond * 10); err != nil {
+			t.Error(err)
+		}
+	}()
+	defer func() {
+		// Unblock the remaining events of the cycle so Close returns.
+		go func() {
+			for range w.Event {
+			}
+		}()
+		w.Close()
+	}()
+
+	expected := map[string]Op{
+		testDir:                              Write,
+		filepath.Join(testDir, "file_1.txt"): Write,
+		filepath.Join(testDir, "file_2.txt"): Remove,
+		filepath.Join(testDir, "new.txt"):    Create,
+		filepath.Join(testDir, "file_4.txt"): Rename,
+	}
+	events := make(map[string]Op)
+	timeout := time.After(time.Millisecond * 500)
+	for len(events) < len(expected) {
+		select {
+		case event := <-w.Event:
+			if _, found := events[event.Path]; found {
+				t.Errorf("expected one event of %s, got %s", event.Path, event)
+			}
+			events[event.Path] = event.Op
+		case <-timeout:
+			t.Fatalf("expected events %v, got %v", expected, events)
+		}
+	}
+	for path, op := range expected {
+		if events[path] != op {
+			t.Errorf("expected %s event of %s, got %s", op, path, events[path])
+		}
+	}
+}
+
+func TestLoadSnapshotVersion(t *testing.T) {
+	snapshotPath := filepath.Join(t.TempDir(), "snapshot.json")
+
+	w := New()
+	if err := w.LoadSnapshot(snapshotPath); err != nil {
+		t.Errorf("expected no error of a missing snapshot, got %v", err)
+	}
+	if err := os.WriteFile(snapshotPath, []byte(`{"version":99}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.LoadSnapshot(snapshotPath); !errors.Is(err, ErrSnapshotVersion) {
+		t.Errorf("expected ErrSnapshotVersion, got %v", err)
+	}
+}
+
+func TestHash(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	touched := filepath.Join(testDir, "file_1.txt")
+	written := filepath.Join(testDir, "file_2.txt")
+	for _, path := range []string{touched, written} {
+		if err := os.WriteFile(path, []byte("a"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := New()
+	w.FilterOps(Write)
+	w.SetHash(HashConfig{New: sha256.New})
+	if err := w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := w.Start(time.Millisecond * 10); err != nil {
+			t.Error(err)
+		}
+	}()
+	defer func() {
+		go func() {
+			for range w.Event {
+			}
+		}()
+		w.Close()
+	}()
+	// Let the first scan hash the files.
+	time.Sleep(time.Millisecond * 50)
+
+	// Touch a file without changing its content.
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(touched, future, future); err != nil {
+		t.Fatal(err)
+	}
+	// Write a file keeping its size and modification time.
+	info, err := os.Stat(written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The file is not truncated, so a scan never finds it empty.
+	f, err := os.OpenFile(written, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteAt([]byte("b"), 0); err != nil {
+		f.Close()
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chtimes(written, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256([]byte("b"))
+	timeout := time.After(time.Millisecond * 250)
+	for {
+		select {
+		case event := <-w.Event:
+			if event.Path == touched {
+				t.Fatalf("expected no event of the touched file, got %s", event)
+			}
+			if event.Path != written {
+				continue
+			}
+			if !bytes.Equal(event.Hash(), sum[:]) {
+				t.Errorf("expected hash %x, got %x", sum, event.Hash())
+			}
+			return
+		case <-timeout:
+			t.Fatal("received no write event")
+		}
+	}
+}
+
+func TestEventMoveDirectory(t *testing.T) {
+	for _, childMoves := range []bool{false, true} {
+		t.Run(fmt.Sprintf("childMoves=%t", childMoves), func(t *testing.T) {
+			testDir, teardown := setup(t)
+			defer teardown()
+
+			srcDir := filepath.Join(testDir, "testDirTwo")
+			dstDir := filepath.Join(testDir, "testDirThree")
+			for i := 0; i < 50; i++ {
+				if err := os.WriteFile(filepath.Join(srcDir, fmt.Sprintf("file_%d.txt", i)), []byte{}, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			w := New()
+			w.ReportChildMoves(childMoves)
+			if err := w.AddRecursive(testDir); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Rename(srcDir, dstDir); err != nil {
+				t.Fatal(err)
+			}
+
+			go func() {
+				if err := w.Start(time.Millisecond * 10); err != nil {
+					t.Error(err)
+				}
+			}()
+			defer func() {
+				go func() {
+					for range w.Event {
+					}
+				}()
+				w.Close()
+			}()
+
+			var renames, moves int
+			timeout := time.After(time.Millisecond * 250)
+			for done := false; !done; {
+				select {
+				case event := <-w.Event:
+					switch {
+					case event.Op == Rename && event.Path == dstDir && event.OldPath == srcDir:
+						renames++
+					case event.Op == Move && filepath.Dir(event.Path) == dstDir && filepath.Dir(event.OldPath) == srcDir &&
+						filepath.Base(event.Path) == filepath.Base(event.OldPath):
+						moves++
+					case event.Op == Write && event.Path == testDir:
+					default:
+						t.Errorf("unexpected event %s from %s", event, event.OldPath)
+					}
+				case <-timeout:
+					done = true
+				}
+			}
+			if renames != 1 {
+				t.Errorf("expected 1 rename event of the directory, got %d", renames)
+			}
+			if expected := map[bool]int{false: 0, true: 51}[childMoves]; moves != expected {
+				t.Errorf("expected %d move events of the paths below the directory, got %d", expected, moves)
+			}
+		})
+	}
+}
+
+func TestIncrementalScan(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	w := New()
+	w.FilterOps(Create)
+	w.SetIncrementalScan(time.Hour)
+	if err := w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := w.Start(time.Millisecond * 10); err != nil {
+			t.Error(err)
+		}
+	}()
+	defer func() {
+		go func() {
+			for range w.Event {
+			}
+		}()
+		w.Close()
+	}()
+	// Let the full scan and a few incremental scans run.
+	time.Sleep(time.Millisecond * 50)
+
+	stats := w.Stats()
+	if stats.FullScans != 1 || stats.Scans < 2 {
+		t.Errorf("expected 1 full scan of at least 2 scans, got %+v", stats)
+	}
+	if stats.DirsSkipped == 0 || stats.StatsSaved == 0 {
+		t.Errorf("expected unchanged directories to be skipped, got %+v", stats)
+	}
+
+	// A new file changes its directory, so it is found by an incremental scan.
+	newFile := filepath.Join(testDir, "testDirTwo", "new.txt")
+	if err := os.WriteFile(newFile, []byte{}, 0755); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-w.Event:
+		if event.Path != newFile {
+			t.Errorf("expected create event of %s, got %s", newFile, event)
+		}
+	case <-time.After(time.Millisecond * 250):
+		t.Error("received no create event")
+	}
+}
+
+func TestIncrementalScanHash(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	w := New()
+	w.SetIncrementalScan(time.Hour)
+	w.SetHash(HashConfig{New: sha256.New})
+	if err := w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := w.Start(time.Millisecond * 5); err != nil {
+			t.Error(err)
+		}
+	}()
+	defer func() {
+		go func() {
+			for range w.Event {
+			}
+		}()
+		w.Close()
+	}()
+	time.Sleep(time.Millisecond * 50)
+
+	// The infos reused from unchanged directories are not wrapped again by
+	// each scan.
+	for path, info := range w.WatchedFiles() {
+		if info.IsDir() {
+			continue
+		}
+		hashed, ok := info.(*hashedFileInfo)
+		if !ok {
+			t.Errorf("expected %s to be hashed", path)
+		} else if _, ok := hashed.FileInfo.(*hashedFileInfo); ok {
+			t.Errorf("expected the info of %s to be hashed once", path)
+		}
+	}
+	if stats := w.Stats(); stats.StatsSaved == 0 {
+		t.Errorf("expected unchanged directories to be skipped, got %+v", stats)
+	}
+}
+
+func TestParallelWalk(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	for i := 0; i < 10; i++ {
+		dir := filepath.Join(testDir, fmt.Sprintf("dir_%d", i), "sub")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 10; j++ {
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file_%d.txt", j)), []byte{}, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	w := New()
+	w.IgnoreHiddenFiles(true)
+	w.SetWalkers(1)
+	sequential, err := w.listRecursive(testDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.SetWalkers(8)
+	parallel, err := w.listRecursive(testDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parallel) != len(sequential) {
+		t.Fatalf("expected %d files, got %d", len(sequential), len(parallel))
+	}
+	for path := range sequential {
+		if _, found := parallel[path]; !found {
+			t.Errorf("expected %s to be listed", path)
+		}
+	}
+	if _, found := parallel[filepath.Join(testDir, ".dotfile")]; found {
+		t.Error("expected the hidden file to be skipped")
+	}
+
+	// The lock is not held while walking, so the watcher is not blocked by a
+	// slow filter hook.
+	release := make(chan struct{})
+	var once sync.Once
+	walking := make(chan struct{})
+	w.AddFilterHook(func(info os.FileInfo, fullPath string) error {
+		once.Do(func() { close(walking) })
+		<-release
+		return nil
+	})
+	done := make(chan error, 1)
+	go func() { done <- w.AddRecursive(testDir) }()
+	<-walking
+	watched := make(chan struct{})
+	go func() {
+		w.WatchedFiles()
+		close(watched)
+	}()
+	select {
+	case <-watched:
+	case <-time.After(time.Second):
+		t.Error("expected WatchedFiles not to be blocked by walking")
+	}
+	close(release)
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(w.WatchedFiles()) != len(sequential) {
+		t.Errorf("expected %d watched files, got %d", len(sequential), len(w.WatchedFiles()))
+	}
+}
+
+func TestAdaptiveInterval(t *testing.T) {
+	s := newScheduler(AdaptiveInterval{Min: 10 * time.Millisecond, Max: 80 * time.Millisecond, MaxScanFraction: 0.5}, time.Second)
+
+	testCases := []struct {
+		scanTime time.Duration
+		isActive bool
+		expected time.Duration
+	}{
+		{0, false, 20 * time.Millisecond},
+		{0, false, 40 * time.Millisecond},
+		{0, false, 80 * time.Millisecond},
+		{0, false, 80 * time.Millisecond},
+		{0, true, 10 * time.Millisecond},
+		{0, false, 20 * time.Millisecond},
+		// The scans take at most half of the wall time.
+		{100 * time.Millisecond, true, 100 * time.Millisecond},
+	}
+	for i, tc := range testCases {
+		if sleep := s.next(tc.scanTime, tc.isActive); sleep != tc.expected {
+			t.Errorf("expected sleep %d to be %s, got %s", i, tc.expected, sleep)
+		}
+	}
+
+	// The duration of Start is used if it is not adaptive.
+	if sleep := newScheduler(AdaptiveInterval{}, time.Second).next(0, false); sleep != time.Second {
+		t.Errorf("expected sleep to be 1s, got %s", sleep)
+	}
+
+	// The scan time budget applies without the backoff too.
+	if sleep := newScheduler(AdaptiveInterval{MaxScanFraction: 0.1}, time.Millisecond).next(time.Second, false); sleep != 9*time.Second {
+		t.Errorf("expected sleep to be 9s, got %s", sleep)
+	}
+
+	// Close ends a long sleep.
+	w := New()
+	go func() {
+		if err := w.Start(time.Hour); err != nil {
+			t.Error(err)
+		}
+	}()
+	w.Wait()
+	time.Sleep(time.Millisecond * 10)
+	closed := make(chan struct{})
+	go func() {
+		w.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("expected Close to end the sleep")
+	}
+}
+
+func TestAddWithInterval(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	w := New()
+	hot, archive := filepath.Join(testDir, "file.txt"), filepath.Join(testDir, "testDirTwo")
+	if err := w.AddWithInterval(hot, time.Millisecond*20); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddRecursiveWithInterval(archive, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// No name is scanned by every cycle, so only the interval of hot wakes it.
+	go func() {
+		if err := w.Start(time.Hour); err != nil {
+			t.Error(err)
+		}
+	}()
+	defer func() {
+		go func() {
+			for range w.Event {
+			}
+		}()
+		w.Close()
+	}()
+	w.Wait()
+
+	if err := os.WriteFile(filepath.Join(archive, "new.txt"), []byte{}, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(hot, []byte("hello"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case event := <-w.Event:
+		if event.Op != Write || event.Path != hot {
+			t.Errorf("expected a write of %s, got %s", hot, event)
+		}
+	case <-time.After(time.Millisecond * 500):
+		t.Fatal("received no event from the hot path")
+	}
+
+	// The archive is not scanned before its interval, its files are kept.
+	select {
+	case event := <-w.Event:
+		t.Errorf("expected no event from the archive, got %s", event)
+	case <-time.After(time.Millisecond * 100):
+	}
+	if _, found := w.WatchedFiles()[filepath.Join(archive, "file_recursive.txt")]; !found {
+		t.Error("expected the files of the archive to be kept between its scans")
+	}
+}
+
+func TestAddWithIntervalCycle(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	w := New()
+	hot, plain := filepath.Join(testDir, "file.txt"), filepath.Join(testDir, "testDirTwo")
+	if err := w.AddWithInterval(hot, time.Millisecond*20); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(plain); err != nil {
+		t.Fatal(err)
+	}
+
+	// The scans of hot do not scan plain before the cycle of Start.
+	go func() {
+		if err := w.Start(time.Hour); err != nil {
+			t.Error(err)
+		}
+	}()
+	defer func() {
+		go func() {
+			for range w.Event {
+			}
+		}()
+		w.Close()
+	}()
+	w.Wait()
+	time.Sleep(time.Millisecond * 20)
+
+	if err := os.WriteFile(filepath.Join(plain, "new.txt"), []byte{}, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(hot, []byte("hello"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(time.Millisecond * 200)
+	for isHot := false; ; {
+		select {
+		case event := <-w.Event:
+			if event.Path != hot {
+				t.Fatalf("expected no event of %s before its cycle, got %s", plain, event)
+			}
+			isHot = true
+		case <-timeout:
+			if !isHot {
+				t.Error("received no event from the hot path")
+			}
+			// The scan time budget delays the scans of hot too.
+			now := time.Now()
+			if next := w.nextScan(now.Add(time.Second)); next.Before(now.Add(time.Second)) {
+				t.Errorf("expected the next scan after the budget, got %s", next.Sub(now))
+			}
+			return
+		}
+	}
+}
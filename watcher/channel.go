@@ -0,0 +1,92 @@
+package watcher
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// chanHandler is the handler forwarding the events to Watcher.Events, it is dispatched like other handlers so it has
+// its own queue and overflow policy. It drops the events until Watcher.Events is called, so a watcher does not block
+// when Watcher.Events is not used.
+type chanHandler struct {
+	events     chan Event
+	subscribed *atomic.Bool
+	closing    <-chan struct{} // closing of the dispatcher, set after the dispatcher is created.
+}
+
+func newChanHandler(buffer int) *chanHandler {
+	return &chanHandler{events: make(chan Event, max(buffer, 0)), subscribed: new(atomic.Bool)}
+}
+
+func (h *chanHandler) FSHandle(event Event) {
+
+	if !h.subscribed.Load() {
+		return
+	}
+	select {
+	case h.events <- event:
+	case <-h.closing:
+	}
+}
+
+// errorsChan forwards the reported errors to Watcher.Errors without blocking, an error is dropped if the channel is
+// full. It drops the errors until Watcher.Errors is called.
+type errorsChan struct {
+	errs       chan error
+	subscribed *atomic.Bool
+	// mu protects closed and sending on errs.
+	mu     *sync.Mutex
+	closed bool
+}
+
+func newErrorsChan(buffer int) *errorsChan {
+	return &errorsChan{errs: make(chan error, max(buffer, 0)), subscribed: new(atomic.Bool), mu: new(sync.Mutex)}
+}
+
+// send puts err into the channel, isSent is false if err is dropped because the channel is full.
+func (c *errorsChan) send(err error) (isSent bool) {
+
+	if !c.subscribed.Load() {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return true
+	}
+	select {
+	case c.errs <- err:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *errorsChan) close() {
+
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.errs)
+	}
+	c.mu.Unlock()
+}
+
+// Events returns the channel receiving the events after the event hook, alongside the handlers. The events before the
+// first call are not sent. It is closed after the watcher stops and the queued events are sent, so it can be ranged
+// over, see WithEventsBuffer for its buffer size.
+func (c *watcherCore) Events() <-chan Event {
+
+	c.eventsHandler.subscribed.Store(true)
+	return c.eventsHandler.events
+}
+
+// Errors returns the channel receiving the errors of the watcher, alongside the error handler. The errors before the
+// first call are not sent, and an error is dropped if the channel is full. It is closed when Events is closed, see
+// WithErrorsBuffer for its buffer size.
+func (c *watcherCore) Errors() <-chan error {
+
+	c.errorsChan.subscribed.Store(true)
+	return c.errorsChan.errs
+}
@@ -0,0 +1,173 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultDebounceWindow is used when DebounceConfig.Window is not greater than 0.
+const DefaultDebounceWindow = 100 * time.Millisecond
+
+// DebounceConfig configures a Debouncer.
+type DebounceConfig struct {
+	// Window is the quiet time, the events of a path are merged and delivered once no event of the path happens in Window.
+	Window time.Duration
+	// MaxWait caps the delay from the first event of a group to its delivery, so continuous writes are still delivered,
+	// there is no cap if MaxWait is not greater than 0.
+	MaxWait time.Duration
+	// Global uses one window for all paths instead of one window per path, events are still merged per path and all
+	// merged events are delivered together in the order their paths first appeared.
+	Global bool
+}
+
+// Debouncer is a FSEventHandler which groups events per path in a quiet window, merges their ops into one event and
+// delivers it to its handlers once, it is used for editors and cp, those produce bursts of Create/Write/Write/Chmod for
+// one logical change. The delivered event is the last event of the group with the merged ops.
+type Debouncer struct {
+	cfg      DebounceConfig
+	handlers []FSEventHandler
+	// mu protects the following.
+	mu          *sync.Mutex
+	pending     map[string]*debounceEntry
+	order       []string    // paths in pending by the first time they appeared, only used in global mode.
+	globalFirst time.Time   // time of the first pending event, only used in global mode.
+	globalTimer *time.Timer // only used in global mode.
+	closed      bool
+}
+
+type debounceEntry struct {
+	et    Event
+	op    Op
+	first time.Time
+	timer *time.Timer
+}
+
+var _ FSEventHandler = (*Debouncer)(nil)
+
+// NewDebouncer returns a Debouncer delivering the merged events to fsEventHandlers, pass it as a FSEventHandler of a Watcher.
+func NewDebouncer(cfg DebounceConfig, fsEventHandlers ...FSEventHandler) *Debouncer {
+
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultDebounceWindow
+	}
+	return &Debouncer{
+		cfg:      cfg,
+		handlers: fsEventHandlers,
+		mu:       new(sync.Mutex),
+		pending:  make(map[string]*debounceEntry, 8),
+	}
+}
+
+// FSHandle implements FSEventHandler, it is the same as Push.
+func (d *Debouncer) FSHandle(event Event) { d.Push(event) }
+
+// Push adds event into the group of its path, after Close, event is delivered at once.
+func (d *Debouncer) Push(event Event) {
+
+	var now = time.Now()
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		d.deliver(event)
+		return
+	}
+	var name = event.Name()
+	var entry, found = d.pending[name]
+	if !found {
+		entry = &debounceEntry{first: now}
+		d.pending[name] = entry
+		if d.cfg.Global {
+			if len(d.order) == 0 {
+				d.globalFirst = now
+			}
+			d.order = append(d.order, name)
+		}
+	}
+	entry.op |= event.Op()
+	entry.et = event
+	if d.cfg.Global {
+		d.globalTimer = d.schedule(d.globalTimer, d.globalFirst, now, d.flushGlobal)
+	} else {
+		entry.timer = d.schedule(entry.timer, entry.first, now, func() { d.flushPath(name, entry) })
+	}
+	d.mu.Unlock()
+}
+
+// schedule starts or resets timer to fire after the quiet window but not later than first+MaxWait.
+func (d *Debouncer) schedule(timer *time.Timer, first, now time.Time, f func()) *time.Timer {
+
+	var delay = d.cfg.Window
+	if d.cfg.MaxWait > 0 {
+		if rest := first.Add(d.cfg.MaxWait).Sub(now); rest < delay {
+			delay = rest
+		}
+	}
+	if timer == nil {
+		return time.AfterFunc(delay, f)
+	}
+	timer.Reset(delay)
+	return timer
+}
+
+func (d *Debouncer) flushPath(name string, entry *debounceEntry) {
+
+	d.mu.Lock()
+	// entry may be delivered by Flush or the timer fires again after Reset.
+	if d.pending[name] != entry {
+		d.mu.Unlock()
+		return
+	}
+	delete(d.pending, name)
+	d.mu.Unlock()
+	d.deliver(entry.et.SetOp(entry.op))
+}
+
+func (d *Debouncer) flushGlobal() { d.deliver(d.takeAll()...) }
+
+// takeAll removes and returns all pending events with merged ops.
+func (d *Debouncer) takeAll() (ets []Event) {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cfg.Global {
+		ets = make([]Event, 0, len(d.order))
+		for _, name := range d.order {
+			var entry = d.pending[name]
+			ets = append(ets, entry.et.SetOp(entry.op))
+		}
+		d.order = d.order[:0]
+		if d.globalTimer != nil {
+			d.globalTimer.Stop()
+		}
+	} else {
+		ets = make([]Event, 0, len(d.pending))
+		for _, entry := range d.pending {
+			entry.timer.Stop()
+			ets = append(ets, entry.et.SetOp(entry.op))
+		}
+	}
+	d.pending = make(map[string]*debounceEntry, 8)
+	return
+}
+
+// Flush delivers all pending events at once.
+func (d *Debouncer) Flush() { d.deliver(d.takeAll()...) }
+
+// Close flushes all pending events, the events pushed after Close are delivered without debouncing.
+func (d *Debouncer) Close() {
+
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+	d.Flush()
+}
+
+func (d *Debouncer) deliver(ets ...Event) {
+
+	for _, et := range ets {
+		for _, handler := range d.handlers {
+			handler.FSHandle(et)
+		}
+	}
+}
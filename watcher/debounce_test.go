@@ -0,0 +1,61 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestDebouncerMergesOps(t *testing.T) {
+
+	for _, global := range []bool{false, true} {
+		var collector = new(eventCollector)
+		var d = NewDebouncer(DebounceConfig{Window: 50 * time.Millisecond, Global: global}, collector)
+		for _, et := range []fsnotify.Event{
+			{Name: "a", Op: fsnotify.Create},
+			{Name: "a", Op: fsnotify.Write},
+			{Name: "b", Op: fsnotify.Chmod},
+			{Name: "a", Op: fsnotify.Write},
+		} {
+			d.FSHandle(newFsnotifyEventWrapper(et))
+		}
+		if !collector.waitFor("a", Create, time.Second) {
+			t.Fatalf("global %t: expected merged event of a", global)
+		}
+		time.Sleep(20 * time.Millisecond)
+		collector.mu.Lock()
+		if len(collector.events) != 2 {
+			t.Fatalf("global %t: expected 2 events, got %d", global, len(collector.events))
+		}
+		for _, et := range collector.events {
+			var expected = Chmod
+			if et.Name() == "a" {
+				expected = Create | Write
+			}
+			if et.Op() != expected {
+				t.Errorf("global %t: expected op of %s to be %s, got %s", global, et.Name(), expected, et.Op())
+			}
+		}
+		collector.mu.Unlock()
+		d.Close()
+	}
+}
+
+func TestDebouncerMaxWait(t *testing.T) {
+
+	var collector = new(eventCollector)
+	var d = NewDebouncer(DebounceConfig{Window: 50 * time.Millisecond, MaxWait: 100 * time.Millisecond}, collector)
+	defer d.Close()
+	var deadline = time.Now().Add(300 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		d.FSHandle(newFsnotifyEventWrapper(fsnotify.Event{Name: "a", Op: fsnotify.Write}))
+		time.Sleep(10 * time.Millisecond)
+	}
+	collector.mu.Lock()
+	var n = len(collector.events)
+	collector.mu.Unlock()
+	if n < 2 {
+		t.Fatalf("expected continuous writes to be flushed by max wait at least twice, got %d", n)
+	}
+}
@@ -0,0 +1,402 @@
+package watcher
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	logger "github.com/xiaoyang-chen/file-watcher/logger"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultQueueSize is the queue size of a handler if it is not set by HandlerQueueSize.
+const DefaultQueueSize = 1024
+
+var (
+	// ErrQueueFull is reported when an event is dropped by OverflowReport.
+	ErrQueueFull = errors.New("error: handler queue is full")
+	// ErrHandlerPanic is the Err of *HandlerError when the handler panics.
+	ErrHandlerPanic = errors.New("error: handler panic")
+)
+
+// HandlerError is reported when a handler panics or FSEventHandlerWithError returns an error.
+type HandlerError struct {
+	Event   Event
+	Handler FSEventHandler
+	Err     error  // the returned error, or ErrHandlerPanic if the handler panics.
+	Panic   any    // the recovered value if the handler panics.
+	Stack   []byte // the stack of the panic.
+}
+
+func (e *HandlerError) Error() string {
+
+	if e.Panic != nil {
+		return fmt.Sprintf("%s: %v, event: %s", e.Err, e.Panic, e.Event)
+	}
+	return fmt.Sprintf("handler error: %s, event: %s", e.Err, e.Event)
+}
+
+func (e *HandlerError) Unwrap() error { return e.Err }
+
+// errorReporter logs the errors and passes them to the error handler set by Watcher.SetErrorHandler and Watcher.Errors.
+type errorReporter struct {
+	logHandler   logger.Logger
+	errs         *errorsChan // used by Watcher.Errors, it may be nil.
+	mu           *sync.RWMutex
+	errorHandler ErrorHandlerFunc
+}
+
+func newErrorReporter(logHandler logger.Logger) *errorReporter {
+	return &errorReporter{logHandler: logHandler, mu: new(sync.RWMutex)}
+}
+
+func (r *errorReporter) set(errorHandler ErrorHandlerFunc) {
+	r.mu.Lock()
+	r.errorHandler = errorHandler
+	r.mu.Unlock()
+}
+
+// report logs err and passes it to the error handler.
+func (r *errorReporter) report(err error) {
+	r.logHandler.Error(err)
+	r.notify(err)
+}
+
+// notify passes err to the error handler without logging.
+func (r *errorReporter) notify(err error) {
+
+	r.mu.RLock()
+	var errorHandler = r.errorHandler
+	r.mu.RUnlock()
+	if errorHandler != nil {
+		errorHandler(err)
+	}
+	if r.errs != nil && !r.errs.send(err) {
+		r.logHandler.Warn("errors chan is full, drop the error ", err)
+	}
+}
+
+// OverflowPolicy decides what to do with a new event when the queue of a handler is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until the handler takes an event from its queue, it slows down the watcher and all other
+	// handlers, and it is the default.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest event in the queue to make room for the new event.
+	OverflowDropOldest
+	// OverflowDropNewest drops the new event.
+	OverflowDropNewest
+	// OverflowReport drops the new event and reports ErrQueueFull with the dropped event.
+	OverflowReport
+)
+
+// HandlerOption configures how events are dispatched to a handler, see ConfigureHandler.
+type HandlerOption func(cfg *handlerConfig)
+
+type handlerConfig struct {
+	queueSize int
+	overflow  OverflowPolicy
+	ops       Op // 0 means all ops.
+	// subscriptions, see isSubscribed.
+	prefixes []string
+	globs    []*GlobFilter
+	kind     PathKind
+	filters  []func(et Event) bool
+}
+
+// HandlerQueueSize sets the queue size of the handler, a size less than 1 means DefaultQueueSize.
+func HandlerQueueSize(size int) HandlerOption {
+	return func(cfg *handlerConfig) { cfg.queueSize = size }
+}
+
+// HandlerOverflow sets what to do when the queue of the handler is full.
+func HandlerOverflow(policy OverflowPolicy) HandlerOption {
+	return func(cfg *handlerConfig) { cfg.overflow = policy }
+}
+
+// HandlerOps sets the ops the handler receives, the other ops are removed from an event and an event without any of
+// ops is not dispatched to the handler. All ops are received if ops is empty.
+func HandlerOps(ops ...Op) HandlerOption {
+	return func(cfg *handlerConfig) { cfg.ops = opMask(ops) }
+}
+
+type configuredHandler struct {
+	FSEventHandler
+	opts []HandlerOption
+}
+
+// ConfigureHandler returns handler with its dispatching options, pass the returned handler to a Watcher instead of
+// handler, the options override the defaults set by WithQueueSize and WithOverflowPolicy.
+func ConfigureHandler(handler FSEventHandler, opts ...HandlerOption) FSEventHandler {
+
+	if ch, ok := handler.(configuredHandler); ok {
+		handler, opts = ch.FSEventHandler, append(append(make([]HandlerOption, 0, len(ch.opts)+len(opts)), ch.opts...), opts...)
+	}
+	return configuredHandler{FSEventHandler: handler, opts: opts}
+}
+
+// dispatcher delivers events to every handler through a queue and a worker goroutine of the handler, so a handler sees
+// events in the order they happened and a burst of events is bounded by the queue size.
+// dispatch must be called by one goroutine.
+type dispatcher struct {
+	logHandler logger.Logger
+	reporter   *errorReporter
+	defaults   handlerConfig
+	closing    chan struct{}
+	closeOnce  *sync.Once
+	draining   chan struct{}
+	drainOnce  *sync.Once
+	wg         *sync.WaitGroup
+	done       chan struct{} // closed when all workers return.
+	// stateMu protects isStopping and starting a worker by subscribe, so a worker is never started after the workers
+	// are told to return. It is not held by dispatch which may block until closing is closed.
+	stateMu    *sync.Mutex
+	isStopping bool // set by close and drain, wg counts 1 for the dispatcher itself until it is set.
+	// mu protects workers, dispatch holds it for reading so a handler is not added or removed in the middle of an event.
+	mu      *sync.RWMutex
+	workers []*handlerWorker
+}
+
+type handlerWorker struct {
+	handler    FSEventHandler
+	cfg        handlerConfig
+	queue      chan Event
+	removed    chan struct{} // closed by the unsubscribe function of subscribe.
+	removeOnce *sync.Once
+}
+
+// newHandlerWorker returns the worker of handler, defaults is used if handler is not returned by ConfigureHandler.
+func newHandlerWorker(handler FSEventHandler, defaults handlerConfig) (worker *handlerWorker) {
+
+	worker = &handlerWorker{handler: handler, cfg: defaults, removed: make(chan struct{}), removeOnce: new(sync.Once)}
+	if ch, ok := handler.(configuredHandler); ok {
+		worker.handler = ch.FSEventHandler
+		for _, opt := range ch.opts {
+			opt(&worker.cfg)
+		}
+	}
+	if worker.cfg.queueSize < 1 {
+		worker.cfg.queueSize = DefaultQueueSize
+	}
+	worker.queue = make(chan Event, worker.cfg.queueSize)
+	return
+}
+
+// newDispatcher starts the workers of handlers, defaults is the handlerConfig of the handlers without options.
+func newDispatcher(logHandler logger.Logger, reporter *errorReporter, defaults handlerConfig, handlers []FSEventHandler) (d *dispatcher) {
+
+	d = &dispatcher{
+		logHandler: logHandler,
+		reporter:   reporter,
+		defaults:   defaults,
+		closing:    make(chan struct{}),
+		closeOnce:  new(sync.Once),
+		draining:   make(chan struct{}),
+		drainOnce:  new(sync.Once),
+		wg:         new(sync.WaitGroup),
+		done:       make(chan struct{}),
+		stateMu:    new(sync.Mutex),
+		mu:         new(sync.RWMutex),
+		workers:    make([]*handlerWorker, 0, len(handlers)),
+	}
+	d.wg.Add(1)
+	for _, handler := range handlers {
+		var worker = newHandlerWorker(handler, defaults)
+		d.workers = append(d.workers, worker)
+		d.wg.Add(1)
+		go d.work(worker)
+	}
+	go func() {
+		d.wg.Wait()
+		close(d.done)
+	}()
+	return
+}
+
+// subscribe starts a worker of handler, see Watcher.Subscribe for the guarantees. isSubscribed is false if the
+// dispatcher is closed or draining, and then unsubscribe does nothing.
+func (d *dispatcher) subscribe(handler FSEventHandler, opts ...HandlerOption) (unsubscribe func(), isSubscribed bool) {
+
+	var worker = newHandlerWorker(ConfigureHandler(handler, opts...), d.defaults)
+	// mu is locked before stateMu, because dispatch may hold mu until closing is closed under stateMu.
+	d.mu.Lock()
+	d.stateMu.Lock()
+	if !d.isStopping {
+		d.wg.Add(1)
+		go d.work(worker)
+		d.workers = append(d.workers[:len(d.workers):len(d.workers)], worker)
+		isSubscribed = true
+	}
+	d.stateMu.Unlock()
+	d.mu.Unlock()
+	if !isSubscribed {
+		return func() {}, false
+	}
+	unsubscribe = func() {
+		worker.removeOnce.Do(func() {
+			// close removed before locking, so a dispatch blocked on the full queue of the worker returns.
+			close(worker.removed)
+			d.mu.Lock()
+			for i, w := range d.workers {
+				if w == worker {
+					d.workers = append(d.workers[:i:i], d.workers[i+1:]...)
+					break
+				}
+			}
+			d.mu.Unlock()
+		})
+	}
+	return unsubscribe, true
+}
+
+func (d *dispatcher) work(worker *handlerWorker) {
+
+	defer d.wg.Done()
+	for {
+		select {
+		case et := <-worker.queue:
+			d.invoke(worker.handler, et)
+		case <-d.closing:
+			return
+		case <-d.draining:
+			// handle the events left in the queue, dispatch is not called anymore.
+			d.handleQueued(worker)
+			return
+		case <-worker.removed:
+			// no more events are queued after the worker is removed.
+			d.handleQueued(worker)
+			return
+		}
+	}
+}
+
+// handleQueued handles the events left in the queue of worker until it is empty or the dispatcher is closed.
+func (d *dispatcher) handleQueued(worker *handlerWorker) {
+
+	for {
+		select {
+		case et := <-worker.queue:
+			d.invoke(worker.handler, et)
+		case <-d.closing:
+			return
+		default:
+			return
+		}
+	}
+}
+
+// invoke calls handler with et, a panic of handler is recovered and reported with the stack, so it only loses et.
+func (d *dispatcher) invoke(handler FSEventHandler, et Event) {
+
+	defer func() {
+		if p := recover(); p != nil {
+			var herr = &HandlerError{Event: et, Handler: handler, Err: ErrHandlerPanic, Panic: p, Stack: debug.Stack()}
+			d.logHandler.Errorf("%s, stack: %s", herr.Error(), herr.Stack)
+			d.reporter.notify(herr)
+		}
+	}()
+	if handlerWithError, ok := handler.(FSEventHandlerWithError); ok {
+		if err := handlerWithError.FSHandleWithError(et); err != nil {
+			d.reporter.report(&HandlerError{Event: et, Handler: handler, Err: err})
+		}
+		return
+	}
+	handler.FSHandle(et)
+}
+
+// dispatch puts et into the queue of every handler subscribed to it.
+func (d *dispatcher) dispatch(et Event) {
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, worker := range d.workers {
+		var out, isKept = maskOp(et, worker.cfg.ops)
+		if !isKept || !worker.cfg.isSubscribed(out) {
+			continue
+		}
+		if !d.enqueue(worker, out) {
+			return
+		}
+	}
+}
+
+// enqueue puts et into the queue of worker by its overflow policy, isOpen is false if the dispatcher was closed.
+func (d *dispatcher) enqueue(worker *handlerWorker, et Event) (isOpen bool) {
+
+	select {
+	case worker.queue <- et:
+		return true
+	case <-d.closing:
+		return false
+	default:
+	}
+	switch worker.cfg.overflow {
+	case OverflowDropOldest:
+		for {
+			select {
+			case worker.queue <- et:
+				return true
+			case <-d.closing:
+				return false
+			case <-worker.removed:
+				return true
+			default:
+			}
+			select {
+			case old := <-worker.queue:
+				d.logHandler.Warn("handler queue is full, drop the oldest event ", old.String())
+			default:
+			}
+		}
+	case OverflowDropNewest:
+		d.logHandler.Warn("handler queue is full, drop the newest event ", et.String())
+		return true
+	case OverflowReport:
+		d.reporter.report(errors.WithMessage(ErrQueueFull, et.String()))
+		return true
+	default:
+		select {
+		case worker.queue <- et:
+			return true
+		case <-d.closing:
+			return false
+		case <-worker.removed:
+			return true
+		}
+	}
+}
+
+// close stops all workers, the events left in the queues are dropped.
+func (d *dispatcher) close() {
+
+	d.closeOnce.Do(func() {
+		d.stateMu.Lock()
+		close(d.closing)
+		d.stop()
+		d.stateMu.Unlock()
+	})
+}
+
+// drain lets the workers return after handling the events left in their queues, it must be called after the last
+// dispatch, wait for done to know when they return.
+func (d *dispatcher) drain() {
+
+	d.drainOnce.Do(func() {
+		d.stateMu.Lock()
+		close(d.draining)
+		d.stop()
+		d.stateMu.Unlock()
+	})
+}
+
+// stop releases the count of the dispatcher in wg once, stateMu must be held.
+func (d *dispatcher) stop() {
+
+	if !d.isStopping {
+		d.isStopping = true
+		d.wg.Done()
+	}
+}
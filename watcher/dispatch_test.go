@@ -0,0 +1,229 @@
+package watcher
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/xiaoyang-chen/file-watcher/logger"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// blockingHandler blocks in FSHandle until release is closed.
+type blockingHandler struct {
+	eventCollector
+	release chan struct{}
+}
+
+func (h *blockingHandler) FSHandle(event Event) {
+	<-h.release
+	h.eventCollector.FSHandle(event)
+}
+
+func TestDispatcherKeepsOrder(t *testing.T) {
+
+	var collector = new(eventCollector)
+	var d = newDispatcher(logger.NewNoop(), newErrorReporter(logger.NewNoop()), handlerConfig{}, []FSEventHandler{collector})
+	defer d.close()
+	for i := 0; i < 100; i++ {
+		d.dispatch(newFsnotifyEventWrapper(fsnotify.Event{Name: strconv.Itoa(i), Op: fsnotify.Write}))
+	}
+	if !collector.waitFor("99", Write, time.Second) {
+		t.Fatal("expected all events to be handled")
+	}
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	for i, et := range collector.events {
+		if et.Name() != strconv.Itoa(i) {
+			t.Fatalf("expected event %d to be %d, got %s", i, i, et.Name())
+		}
+	}
+}
+
+func TestDispatcherOverflow(t *testing.T) {
+
+	testCases := []struct {
+		policy   OverflowPolicy
+		expected []string
+	}{
+		// the first event is taken by the worker before the queue is full.
+		{OverflowDropOldest, []string{"0", "3", "4"}},
+		{OverflowDropNewest, []string{"0", "1", "2"}},
+		{OverflowReport, []string{"0", "1", "2"}},
+	}
+	for _, tc := range testCases {
+		var handler = &blockingHandler{release: make(chan struct{})}
+		var d = newDispatcher(logger.NewNoop(), newErrorReporter(logger.NewNoop()), handlerConfig{}, []FSEventHandler{
+			ConfigureHandler(handler, HandlerQueueSize(2), HandlerOverflow(tc.policy)),
+		})
+		d.dispatch(newFsnotifyEventWrapper(fsnotify.Event{Name: "0", Op: fsnotify.Write}))
+		// wait for the worker to take the first event.
+		time.Sleep(20 * time.Millisecond)
+		for i := 1; i < 5; i++ {
+			d.dispatch(newFsnotifyEventWrapper(fsnotify.Event{Name: strconv.Itoa(i), Op: fsnotify.Write}))
+		}
+		close(handler.release)
+		if !handler.waitFor(tc.expected[len(tc.expected)-1], Write, time.Second) {
+			t.Fatalf("policy %d: expected event %s to be handled", tc.policy, tc.expected[len(tc.expected)-1])
+		}
+		handler.mu.Lock()
+		if len(handler.events) != len(tc.expected) {
+			t.Errorf("policy %d: expected %d events, got %d", tc.policy, len(tc.expected), len(handler.events))
+		}
+		for i, et := range handler.events {
+			if i < len(tc.expected) && et.Name() != tc.expected[i] {
+				t.Errorf("policy %d: expected event %d to be %s, got %s", tc.policy, i, tc.expected[i], et.Name())
+			}
+		}
+		handler.mu.Unlock()
+		d.close()
+	}
+}
+
+type panicHandler struct{}
+
+func (panicHandler) FSHandle(event Event) { panic("boom " + event.Name()) }
+
+type errorHandler struct{ eventCollector }
+
+func (h *errorHandler) FSHandleWithError(event Event) error {
+	h.FSHandle(event)
+	return errors.New("fail " + event.Name())
+}
+
+func TestDispatcherHandlerErrors(t *testing.T) {
+
+	var reporter = newErrorReporter(logger.NewNoop())
+	var errs = make(chan error, 4)
+	reporter.set(func(err error) { errs <- err })
+	var handler = new(errorHandler)
+	var d = newDispatcher(logger.NewNoop(), reporter, handlerConfig{}, []FSEventHandler{panicHandler{}, handler})
+	defer d.close()
+	d.dispatch(newFsnotifyEventWrapper(fsnotify.Event{Name: "a", Op: fsnotify.Write}))
+	d.dispatch(newFsnotifyEventWrapper(fsnotify.Event{Name: "b", Op: fsnotify.Write}))
+	if !handler.waitFor("b", Write, time.Second) {
+		t.Fatal("expected handler to keep working after another handler panics")
+	}
+	var panics, returned = 0, 0
+	for i := 0; i < 4; i++ {
+		select {
+		case err := <-errs:
+			var herr *HandlerError
+			if !errors.As(err, &herr) {
+				t.Fatalf("expected *HandlerError, got %T", err)
+			}
+			if errors.Is(err, ErrHandlerPanic) {
+				if len(herr.Stack) == 0 {
+					t.Error("expected the stack of the panic")
+				}
+				panics++
+			} else {
+				returned++
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected 4 errors")
+		}
+	}
+	if panics != 2 || returned != 2 {
+		t.Errorf("expected 2 panics and 2 returned errors, got %d and %d", panics, returned)
+	}
+}
+
+func TestOpsMask(t *testing.T) {
+
+	var testDir = t.TempDir()
+	var all, removes = new(eventCollector), new(eventCollector)
+	var w, err = New(BackendFsnotify, WithOps(Create, Remove), WithHandlers(all, ConfigureHandler(removes, HandlerOps(Remove))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err = w.AddPaths(testDir); err != nil {
+		t.Fatal(err)
+	}
+	var file = filepath.Join(testDir, "file.txt")
+	if err = os.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chmod(file, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if !all.waitFor(file, Remove, time.Second) || !removes.waitFor(file, Remove, time.Second) {
+		t.Fatal("expected remove events")
+	}
+	all.mu.Lock()
+	defer all.mu.Unlock()
+	for _, et := range all.events {
+		if et.Op()&^(Create|Remove) != 0 {
+			t.Errorf("expected only create and remove, got %s", et)
+		}
+	}
+	removes.mu.Lock()
+	defer removes.mu.Unlock()
+	for _, et := range removes.events {
+		if et.Op() != Remove {
+			t.Errorf("expected only remove, got %s", et)
+		}
+	}
+}
+
+func TestDispatcherSubscribe(t *testing.T) {
+
+	var audit = new(eventCollector)
+	var d = newDispatcher(logger.NewNoop(), newErrorReporter(logger.NewNoop()), handlerConfig{}, []FSEventHandler{audit})
+	var dispatch = func(names ...string) {
+		for _, name := range names {
+			d.dispatch(newFsnotifyEventWrapper(fsnotify.Event{Name: name, Op: fsnotify.Write}))
+		}
+	}
+	dispatch("0")
+	var collector = new(eventCollector)
+	var unsubscribe, isSubscribed = d.subscribe(collector)
+	if !isSubscribed {
+		t.Fatal("expected the handler to be subscribed")
+	}
+	dispatch("1", "2")
+	unsubscribe()
+	unsubscribe()
+	dispatch("3")
+	if !audit.waitFor("3", Write, time.Second) || !collector.waitFor("2", Write, time.Second) {
+		t.Fatal("expected all events to be handled")
+	}
+	collector.mu.Lock()
+	if len(collector.events) != 2 || collector.events[0].Name() != "1" {
+		t.Errorf("expected events 1 and 2, got %v", collector.events)
+	}
+	collector.mu.Unlock()
+	// unsubscribe returns a dispatch blocked on the full queue of the handler.
+	var blocked = &blockingHandler{release: make(chan struct{})}
+	unsubscribe, _ = d.subscribe(blocked, HandlerQueueSize(1))
+	var dispatched = make(chan struct{})
+	go func() {
+		dispatch("4", "5", "6")
+		close(dispatched)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	unsubscribe()
+	select {
+	case <-dispatched:
+	case <-time.After(time.Second):
+		t.Fatal("expected dispatch to return after unsubscribe")
+	}
+	close(blocked.release)
+	d.close()
+	if _, isSubscribed = d.subscribe(new(eventCollector)); isSubscribed {
+		t.Error("expected subscribe to fail after close")
+	}
+	select {
+	case <-d.done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the workers to return after close")
+	}
+}
@@ -1,6 +1,12 @@
 package watcher
 
 import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
 	radovskybwatcher "github.com/xiaoyang-chen/file-watcher/radovskyb-watcher"
 
 	"github.com/fsnotify/fsnotify"
@@ -30,47 +36,229 @@ const (
 	// get triggered very frequently by some software. For example, Spotlight
 	// indexing on macOS, anti-virus software, backup software, etc.
 	Chmod Op = fsnotify.Chmod
+	// The path was moved into another directory, the new path is [Event.Name] and the old path is [Event.OldName].
+	//
+	// It is not an op of fsnotify, a renamed path which stays in the same directory is reported as Rename, and both
+	// of them have the old path.
+	Move Op = 1 << 15
 )
 
+// opString returns the string of op like [fsnotify.Op.String] but with Move.
+func opString(op Op) string {
+
+	if !op.Has(Move) {
+		return op.String()
+	}
+	if op &^= Move; op == 0 {
+		return "MOVE"
+	}
+	return op.String() + "|MOVE"
+}
+
+// opMask returns the union of ops, 0 means all ops.
+func opMask(ops []Op) (mask Op) {
+
+	for _, op := range ops {
+		mask |= op
+	}
+	return
+}
+
+// maskOp removes the ops not in mask from et, isKept is false if et has no op in mask. All ops are kept if mask is 0.
+func maskOp(et Event, mask Op) (out Event, isKept bool) {
+
+	if mask == 0 {
+		return et, true
+	}
+	var op = et.Op() & mask
+	if op == 0 {
+		return et, false
+	}
+	if op != et.Op() {
+		et = et.SetOp(op)
+	}
+	return et, true
+}
+
 var _mapRadovskybwatcherOp = map[radovskybwatcher.Op]Op{
 	radovskybwatcher.Create: Create,
 	radovskybwatcher.Write:  Write,
 	radovskybwatcher.Remove: Remove,
 	radovskybwatcher.Rename: Rename,
 	radovskybwatcher.Chmod:  Chmod,
+	radovskybwatcher.Move:   Move,
 }
 
 type Event interface {
 	// Name return the path to the file or directory.
 	Name() string
+	// OldName returns the previous path of a renamed or moved path, it is empty if the event is not Rename or Move, or
+	// the new path of a renamed path is unknown, such as the path was moved out of the watched directories.
+	OldName() string
+	// Op returns all ops of the event.
+	Op() Op
 	Has(op Op) bool
 	String() string
 	SetOp(op Op) Event
+	// FileInfo returns the info of the path, the fsnotify backend stats the path when it is called the first time, it is
+	// nil if the path does not exist anymore.
+	FileInfo() os.FileInfo
+	// Time returns when the event was observed by the watcher.
+	Time() time.Time
+	// Seq returns the sequence number of the event, it increases monotonically in the order the events are passed to the
+	// event hook of a watcher.
+	Seq() uint64
+	// Source returns the backend producing the event.
+	Source() Backend
+	// WithValue returns a copy of the event with the value of key, it is used to annotate an event, see AnnotateStage.
+	WithValue(key, value any) Event
+	// Value returns the value of key set by WithValue, nil if it is not set.
+	Value(key any) any
+}
+
+// eventMeta is set when an event is observed by a watcher, see stampEvent.
+type eventMeta struct {
+	at     time.Time
+	seq    uint64
+	source Backend
+	values *eventValue
+}
+
+// eventValue is an immutable list of the values set by Event.WithValue, the last value is the head.
+type eventValue struct {
+	parent     *eventValue
+	key, value any
+}
+
+func (m eventMeta) Time() time.Time { return m.at }
+func (m eventMeta) Seq() uint64     { return m.seq }
+func (m eventMeta) Source() Backend { return m.source }
+func (m eventMeta) Value(key any) any {
+
+	for v := m.values; v != nil; v = v.parent {
+		if v.key == key {
+			return v.value
+		}
+	}
+	return nil
+}
+
+func (m eventMeta) withValue(key, value any) eventMeta {
+	m.values = &eventValue{parent: m.values, key: key, value: value}
+	return m
+}
+
+// stampEvent sets at, seq and source of et which is created by a watcher.
+func stampEvent(et Event, at time.Time, seq uint64, source Backend) Event {
+
+	switch w := et.(type) {
+	case fsnotifyEventWrapper:
+		w.at, w.seq, w.source = at, seq, source
+		return w
+	case radovskybwatcherEventWrapper:
+		w.at, w.seq, w.source = at, seq, source
+		return w
+	}
+	return et
+}
+
+// lazyFileInfo stats name once when it is needed.
+type lazyFileInfo struct {
+	once *sync.Once
+	name string
+	info os.FileInfo
+}
+
+func (l *lazyFileInfo) get() os.FileInfo {
+
+	l.once.Do(func() {
+		if info, err := os.Lstat(l.name); err == nil {
+			l.info = info
+		}
+	})
+	return l.info
 }
 
 var _ Event = fsnotifyEventWrapper{}
 var _ Event = radovskybwatcherEventWrapper{}
 
 type fsnotifyEventWrapper struct {
-	e fsnotify.Event
+	eventMeta
+	e       fsnotify.Event
+	oldName string // set by renamePairer.
+	info    *lazyFileInfo
 }
 
-func (w fsnotifyEventWrapper) Name() string      { return w.e.Name }
-func (w fsnotifyEventWrapper) String() string    { return w.e.String() }
+func (w fsnotifyEventWrapper) Name() string    { return w.e.Name }
+func (w fsnotifyEventWrapper) OldName() string { return w.oldName }
+func (w fsnotifyEventWrapper) Op() Op          { return w.e.Op }
+func (w fsnotifyEventWrapper) String() string {
+
+	if w.oldName != "" {
+		return fmt.Sprintf("%-13s %q ← %q", opString(w.e.Op), w.e.Name, w.oldName)
+	}
+	return fmt.Sprintf("%-13s %q", opString(w.e.Op), w.e.Name)
+}
 func (w fsnotifyEventWrapper) Has(op Op) bool    { return w.e.Has(op) }
 func (w fsnotifyEventWrapper) SetOp(op Op) Event { w.e.Op = op; return w }
+func (w fsnotifyEventWrapper) WithValue(key, value any) Event {
+	w.eventMeta = w.withValue(key, value)
+	return w
+}
+
+func (w fsnotifyEventWrapper) FileInfo() os.FileInfo {
+
+	if w.info == nil {
+		return nil
+	}
+	return w.info.get()
+}
 
 type radovskybwatcherEventWrapper struct {
+	eventMeta
 	e      radovskybwatcher.Event
 	wrapOp Op // see _mapRadovskybwatcherOp
 }
 
-func (w radovskybwatcherEventWrapper) Name() string      { return w.e.Path }
-func (w radovskybwatcherEventWrapper) String() string    { return w.e.String() }
+func (w radovskybwatcherEventWrapper) Name() string { return w.e.Path }
+func (w radovskybwatcherEventWrapper) OldName() string {
+
+	// radovskybwatcher sets OldPath to Path for the events those are not rename or move.
+	if w.e.Op != radovskybwatcher.Rename && w.e.Op != radovskybwatcher.Move {
+		return ""
+	}
+	return w.e.OldPath
+}
+func (w radovskybwatcherEventWrapper) Op() Op { return w.wrapOp }
+func (w radovskybwatcherEventWrapper) String() string {
+
+	if w.e.FileInfo == nil {
+		return "???"
+	}
+	var pathType = "FILE"
+	if w.e.IsDir() {
+		pathType = "DIRECTORY"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %q %s [%s]", pathType, w.e.Name(), opString(w.wrapOp), w.e.Path)
+	if oldName := w.OldName(); oldName != "" {
+		fmt.Fprintf(&b, " ← %q", oldName)
+	}
+	return b.String()
+}
 func (w radovskybwatcherEventWrapper) Has(op Op) bool    { return w.wrapOp.Has(op) }
 func (w radovskybwatcherEventWrapper) SetOp(op Op) Event { w.wrapOp = op; return w }
+func (w radovskybwatcherEventWrapper) WithValue(key, value any) Event {
+	w.eventMeta = w.withValue(key, value)
+	return w
+}
+func (w radovskybwatcherEventWrapper) FileInfo() os.FileInfo { return w.e.FileInfo }
 
-func newFsnotifyEventWrapper(e fsnotify.Event) Event { return fsnotifyEventWrapper{e: e} }
+func newFsnotifyEventWrapper(e fsnotify.Event) Event { return newFsnotifyRenameEventWrapper(e, "") }
+
+func newFsnotifyRenameEventWrapper(e fsnotify.Event, oldName string) Event {
+	return fsnotifyEventWrapper{e: e, oldName: oldName, info: &lazyFileInfo{once: new(sync.Once), name: e.Name}}
+}
 
 func newRadovskybwatcherEventWrapper(e radovskybwatcher.Event) (ifsEvent Event) {
 	return radovskybwatcherEventWrapper{e: e, wrapOp: _mapRadovskybwatcherOp[e.Op]}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package watcher
+
+import "io/fs"
+
+// fileID identifies a file by its metadata, the file index is not in the fs.FileInfo on this platform, so a renamed
+// path is paired with a created one of the same modification time, size and mode.
+type fileID struct {
+	modTime int64
+	size    int64
+	mode    fs.FileMode
+}
+
+// fileIDOf returns the id of info, it is always known.
+func fileIDOf(info fs.FileInfo) (id fileID, isKnown bool) {
+	return fileID{modTime: info.ModTime().UnixNano(), size: info.Size(), mode: info.Mode()}, true
+}
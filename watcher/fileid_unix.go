@@ -0,0 +1,22 @@
+//go:build unix
+
+package watcher
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileID identifies a file by its device and inode number.
+type fileID struct {
+	dev, ino uint64
+}
+
+// fileIDOf returns the id of info, isKnown is false if info has no inode number.
+func fileIDOf(info fs.FileInfo) (id fileID, isKnown bool) {
+
+	if sys, ok := info.Sys().(*syscall.Stat_t); ok {
+		id = fileID{dev: uint64(sys.Dev), ino: uint64(sys.Ino)}
+	}
+	return id, id.ino != 0
+}
@@ -0,0 +1,271 @@
+package watcher
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fsnotify drops events when the queue of the kernel overflows, and it misses the changes on some filesystems, so the
+// reconciler keeps a snapshot of the watched paths and compares it with a scan of the tree to find the missing events.
+
+// reconciledKey is the key of Event.Value set on the events synthesized by a reconciliation scan.
+type reconciledKey struct{}
+
+// IsReconciled reports whether et is synthesized by a reconciliation scan instead of reported by the backend, see
+// WithReconcile.
+func IsReconciled(et Event) bool {
+
+	var isReconciled, _ = et.Value(reconciledKey{}).(bool)
+	return isReconciled
+}
+
+// fileState is the state of a path compared by the reconciler.
+type fileState struct {
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+func newFileState(info fs.FileInfo) fileState {
+	return fileState{size: info.Size(), modTime: info.ModTime(), isDir: info.IsDir()}
+}
+
+// reconciler is the snapshot of the paths watched by fsnotify, it is updated by the events of the backend and by seed
+// when a path is added. A name is scanned by reconcile only after it is seeded, else the paths found by walking it
+// would be reported as created.
+type reconciler struct {
+	interval time.Duration // 0 means only reconciling on overflow.
+	// mu protects states and names.
+	mu     *sync.Mutex
+	states map[string]fileState
+	names  map[string]bool // the seeded names and whether they are seeded recursively.
+}
+
+func newReconciler(interval time.Duration) *reconciler {
+	return &reconciler{interval: max(interval, 0), mu: new(sync.Mutex), states: make(map[string]fileState, 64),
+		names: make(map[string]bool, 4)}
+}
+
+// ticker returns the channel of the reconciliation interval and the function stopping it, the channel is nil if there
+// is no interval.
+func (r *reconciler) ticker() (c <-chan time.Time, stop func()) {
+
+	if r.interval == 0 {
+		return nil, func() {}
+	}
+	var t = time.NewTicker(r.interval)
+	return t.C, t.Stop
+}
+
+// seed merges states of name into the snapshot without reporting them.
+func (r *reconciler) seed(name string, recursive bool, states map[string]fileState) {
+
+	r.mu.Lock()
+	for path, state := range states {
+		r.states[path] = state
+	}
+	r.names[name] = r.names[name] || recursive
+	r.mu.Unlock()
+}
+
+// seededNames returns the seeded names those are in names, and forgets the others with the paths only below them.
+func (r *reconciler) seededNames(names map[string]bool) (seeded map[string]bool) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var isForgotten bool
+	seeded = make(map[string]bool, len(r.names))
+	for name, recursive := range r.names {
+		if _, found := names[name]; found {
+			seeded[name] = recursive
+		} else {
+			delete(r.names, name)
+			isForgotten = true
+		}
+	}
+	if !isForgotten {
+		return
+	}
+	for path := range r.states {
+		if !isCoveredByNames(path, r.names) {
+			delete(r.states, path)
+		}
+	}
+	return
+}
+
+// observe updates the snapshot by the current state of the path of et, the paths below a removed directory are removed.
+func (r *reconciler) observe(et fsnotify.Event) {
+
+	var info, err = os.Lstat(et.Name)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err == nil {
+		r.states[et.Name] = newFileState(info)
+		return
+	}
+	var state, found = r.states[et.Name]
+	delete(r.states, et.Name)
+	if found && state.isDir {
+		for path := range r.states {
+			if isPathBelow(path, et.Name) {
+				delete(r.states, path)
+			}
+		}
+	}
+}
+
+// diff replaces the snapshot by current, the scan of names, and returns the events of the differences: Create for the
+// new paths, Write for the files whose size or modification time changed, and Remove for the paths gone. The changes
+// of the directories themselves and the mode are not reported. The paths not covered by names are kept, they are seeded
+// by a name added during the scan.
+func (r *reconciler) diff(current map[string]fileState, names map[string]bool) (ets []fsnotify.Event) {
+
+	r.mu.Lock()
+	var previous = r.states
+	for path, state := range previous {
+		if _, found := current[path]; !found && !isCoveredByNames(path, names) {
+			current[path] = state
+		}
+	}
+	var created, removed = make([]string, 0, 4), make([]string, 0, 4)
+	for path, state := range current {
+		var old, found = previous[path]
+		switch {
+		case !found:
+			created = append(created, path)
+		case !state.isDir && (old.size != state.size || !old.modTime.Equal(state.modTime)):
+			ets = append(ets, fsnotify.Event{Name: path, Op: fsnotify.Write})
+		}
+	}
+	for path := range previous {
+		if _, found := current[path]; !found {
+			removed = append(removed, path)
+		}
+	}
+	// current is updated by the events after it replaces the snapshot.
+	r.states = current
+	r.mu.Unlock()
+	// a directory is created before and removed after the paths below it.
+	sort.Strings(created)
+	sort.Sort(sort.Reverse(sort.StringSlice(removed)))
+	sort.Slice(ets, func(i, j int) bool { return ets[i].Name < ets[j].Name })
+	for _, path := range created {
+		ets = append(ets, fsnotify.Event{Name: path, Op: fsnotify.Create})
+	}
+	for _, path := range removed {
+		ets = append(ets, fsnotify.Event{Name: path, Op: fsnotify.Remove})
+	}
+	return
+}
+
+// scanStates returns the states of the watched names and the paths below them those are watched by fsnotify, the
+// paths which can not be read are skipped.
+func (w fsnotifyWatcherWrapper) scanStates(names map[string]bool) (states map[string]fileState) {
+
+	states = make(map[string]fileState, 64)
+	for name, recursive := range names {
+		var info, err = os.Lstat(name)
+		if err != nil {
+			continue
+		}
+		states[name] = newFileState(info)
+		if !info.IsDir() {
+			continue
+		}
+		if recursive {
+			_ = filepath.WalkDir(name, func(path string, d fs.DirEntry, err error) error {
+				if err != nil || path == name {
+					return nil
+				}
+				if (w.ignoreHidden && isHiddenPath(path)) || w.isPathExcluded(path, d.IsDir()) {
+					if d.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if info, err := d.Info(); err == nil {
+					states[path] = newFileState(info)
+				}
+				return nil
+			})
+			continue
+		}
+		var entries, _ = os.ReadDir(name)
+		for _, entry := range entries {
+			var path = filepath.Join(name, entry.Name())
+			if (w.ignoreHidden && isHiddenPath(path)) || w.isPathExcluded(path, entry.IsDir()) {
+				continue
+			}
+			if info, err := entry.Info(); err == nil {
+				states[path] = newFileState(info)
+			}
+		}
+	}
+	return
+}
+
+// seedName adds name and the paths below it to the snapshot after name is added.
+func (w fsnotifyWatcherWrapper) seedName(name string, recursive bool) {
+
+	if w.reconciler != nil {
+		w.reconciler.seed(name, recursive, w.scanStates(map[string]bool{name: recursive}))
+	}
+}
+
+// reconcile scans the watched names and returns the events missed since the last scan, it is called by the event loop.
+func (w fsnotifyWatcherWrapper) reconcile() (ets []fsnotify.Event) {
+
+	// the names are read with the seeded names together, so a name removed and added again is not forgotten after it
+	// is seeded.
+	w.mu.Lock()
+	var names = w.reconciler.seededNames(w.names)
+	w.mu.Unlock()
+	for _, et := range w.reconciler.diff(w.scanStates(names), names) {
+		if et.Has(fsnotify.Remove) {
+			w.forgetNames(et.Name)
+			w.removeDirs(et.Name)
+		}
+		// a directory missed by fsnotify is not watched yet.
+		if et.Has(fsnotify.Create) && w.isBelowRecursive(et.Name) {
+			if stat, err := os.Lstat(et.Name); err == nil && stat.IsDir() {
+				if _, err = w.addDirsRecursive(et.Name); err != nil {
+					w.logHandler.Error("add missed directory recursively fail, err: ", err)
+				}
+			}
+		}
+		if w.isGlobKept(et.Name) {
+			ets = append(ets, et)
+		}
+	}
+	return
+}
+
+// handleReconciled passes the events found by reconcile to the core, the pending rename is flushed first to keep the
+// order of the events.
+func (w fsnotifyWatcherWrapper) handleReconciled(pairer *renamePairer) {
+
+	w.handleEvents(BackendFsnotify, pairer.flush()...)
+	for _, et := range w.reconcile() {
+		w.handleEvents(BackendFsnotify, newFsnotifyEventWrapper(et).WithValue(reconciledKey{}, true))
+	}
+}
+
+// isCoveredByNames reports whether path is a name, a path directly in a name, or a path below a recursive name.
+func isCoveredByNames(path string, names map[string]bool) bool {
+
+	for name, recursive := range names {
+		if path == name || filepath.Dir(path) == name || (recursive && isPathBelow(path, name)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFsnotifyReconcile(t *testing.T) {
+
+	var testDir = t.TempDir()
+	var file = filepath.Join(testDir, "sub", "file.txt")
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var collector = new(eventCollector)
+	var w, err = New(BackendFsnotify, WithReconcile(20*time.Millisecond), WithHandlers(collector))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err = w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+	// make the snapshot miss file and have a path which does not exist, like the events are dropped.
+	var r = w.(fsnotifyWatcherWrapper).reconciler
+	var ghost = filepath.Join(testDir, "ghost.txt")
+	r.mu.Lock()
+	delete(r.states, file)
+	r.states[ghost] = fileState{size: 1}
+	r.mu.Unlock()
+	if !collector.waitFor(file, Create, time.Second) || !collector.waitFor(ghost, Remove, time.Second) {
+		t.Fatal("expected the missed events to be synthesized")
+	}
+	// the events reported by fsnotify are kept in the snapshot, so they are not synthesized again.
+	var other = filepath.Join(testDir, "sub", "other.txt")
+	if err = os.WriteFile(other, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !collector.waitFor(other, Create, time.Second) {
+		t.Fatalf("expected create event of %s", other)
+	}
+	time.Sleep(60 * time.Millisecond)
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	for _, et := range collector.events {
+		var expected = et.Name() == file || et.Name() == ghost
+		if IsReconciled(et) != expected {
+			t.Errorf("expected reconciled of %s to be %t", et, expected)
+		}
+	}
+}
+
+func TestFsnotifyReconcileUnseededName(t *testing.T) {
+
+	var testDir = t.TempDir()
+	var file = filepath.Join(testDir, "sub", "file.txt")
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var collector = new(eventCollector)
+	var w, err = New(BackendFsnotify, WithReconcile(10*time.Millisecond), WithHandlers(collector))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	// AddRecursive publishes the name before walking it, the reconciliation scans must skip it until it is seeded.
+	var wrapper = w.(fsnotifyWatcherWrapper)
+	wrapper.mu.Lock()
+	wrapper.names[testDir] = true
+	wrapper.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	wrapper.seedName(testDir, true)
+	time.Sleep(50 * time.Millisecond)
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	for _, et := range collector.events {
+		t.Errorf("expected no event of the existing paths, got %s", et)
+	}
+}
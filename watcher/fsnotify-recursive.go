@@ -0,0 +1,220 @@
+package watcher
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// fsnotify only watches the directory itself, so for recursive watching we add every directory below the root and follow
+// the create, remove and rename events to keep the watched directories in step with the tree.
+
+// addDirsRecursive watches root, which may be a file, and every directory below it, found returns all paths below root (root excluded) in walking order.
+func (w fsnotifyWatcherWrapper) addDirsRecursive(root string) (found []string, err error) {
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, inErr error) (err error) {
+		if inErr != nil {
+			// path may be removed between reading its parent and walking it, skip it if it is not the root.
+			if path != root && os.IsNotExist(inErr) {
+				return
+			}
+			err = errors.WithStack(inErr)
+			return
+		}
+		if path != root {
+			if w.ignoreHidden && isHiddenPath(path) {
+				if d.IsDir() {
+					err = filepath.SkipDir
+				}
+				return
+			}
+			if w.isPathExcluded(path, d.IsDir()) {
+				if d.IsDir() {
+					err = filepath.SkipDir
+				}
+				return
+			}
+			// a directory not included is still walked for the files below it.
+			if w.isGlobKept(path) {
+				found = append(found, path)
+			}
+		}
+		if info, err := d.Info(); err == nil {
+			w.ids.remember(path, info)
+		}
+		// a root which is a file is watched like a path added by AddPaths.
+		if !d.IsDir() && path != root {
+			return
+		}
+		if err = w.watcher.Add(path); err != nil {
+			err = errors.WithStack(err)
+			return
+		}
+		w.mu.Lock()
+		w.dirs[path] = struct{}{}
+		w.mu.Unlock()
+		return
+	})
+	return
+}
+
+// roots returns the watched names.
+func (w fsnotifyWatcherWrapper) roots() (roots []string) {
+
+	w.mu.Lock()
+	roots = make([]string, 0, len(w.names))
+	for name := range w.names {
+		roots = append(roots, name)
+	}
+	w.mu.Unlock()
+	return
+}
+
+// isGlobKept reports whether path is kept by the glob filter, a path not below any watched name is kept.
+func (w fsnotifyWatcherWrapper) isGlobKept(path string) bool {
+
+	if w.globFilter == nil {
+		return true
+	}
+	var rel, isFound = relToRoots(path, w.roots())
+	return !isFound || w.globFilter.Match(rel)
+}
+
+// isPathExcluded reports whether path is excluded by the glob filter or ignored by the ignore files, an excluded
+// directory is not walked.
+func (w fsnotifyWatcherWrapper) isPathExcluded(path string, isDir bool) bool {
+
+	if w.globFilter == nil && w.gitIgnore == nil {
+		return false
+	}
+	var root, isFound = rootOf(path, w.roots())
+	if !isFound {
+		return false
+	}
+	if rel, err := filepath.Rel(root, path); err == nil && w.globFilter != nil && w.globFilter.IsExcluded(rel) {
+		return true
+	}
+	return w.gitIgnore != nil && w.gitIgnore.isIgnored(root, path, isDir)
+}
+
+// isEventExcluded is isPathExcluded for the path of an event, which may not exist anymore and then it is not a directory.
+func (w fsnotifyWatcherWrapper) isEventExcluded(path string) bool {
+
+	var isDir bool
+	if w.gitIgnore != nil {
+		var stat, err = os.Lstat(path)
+		isDir = err == nil && stat.IsDir()
+	}
+	return w.isPathExcluded(path, isDir)
+}
+
+// followIgnoreFile reads the rules again if path is an ignore file, and walks its directory again if it is below a
+// recursive root for the directories not ignored anymore. The directories ignored now are still watched, but their
+// events are dropped.
+func (w fsnotifyWatcherWrapper) followIgnoreFile(path string) {
+
+	if w.gitIgnore == nil {
+		return
+	}
+	var dir, isIgnoreFile = w.gitIgnore.invalidate(path)
+	if !isIgnoreFile || !w.isBelowRecursive(dir) {
+		return
+	}
+	if _, err := w.addDirsRecursive(dir); err != nil {
+		w.logHandler.Error("walk directory of ignore file fail, err: ", err)
+	}
+}
+
+// isBelowRecursive reports whether path is a recursive root or below one.
+func (w fsnotifyWatcherWrapper) isBelowRecursive(path string) (isBelow bool) {
+
+	w.mu.Lock()
+	for name, recursive := range w.names {
+		if isBelow = recursive && isPathBelow(path, name); isBelow {
+			break
+		}
+	}
+	w.mu.Unlock()
+	return
+}
+
+// removeDirs drops the watches of dir and all directories below it if they are watched because of a recursive root,
+// the directories still needed by a watched name, a recursive root above them or the name itself, are kept.
+func (w fsnotifyWatcherWrapper) removeDirs(dir string) {
+
+	var removed = make([]string, 0, 1)
+	w.mu.Lock()
+	for path := range w.dirs {
+		if isPathBelow(path, dir) && !w.isNeeded(path) {
+			delete(w.dirs, path)
+			removed = append(removed, path)
+		}
+	}
+	w.mu.Unlock()
+	for _, path := range removed {
+		// the watch is removed by fsnotify when the directory is removed, so the error can be ignored.
+		_ = w.watcher.Remove(path)
+	}
+}
+
+// isNeeded reports whether the watch of path is needed by a watched name, w.mu must be held.
+func (w fsnotifyWatcherWrapper) isNeeded(path string) bool {
+
+	for name, recursive := range w.names {
+		if path == name || (recursive && isPathBelow(path, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetNames forgets the watched names those are dir or below it, it is called when dir is removed or renamed.
+func (w fsnotifyWatcherWrapper) forgetNames(dir string) {
+
+	w.mu.Lock()
+	for name := range w.names {
+		if isPathBelow(name, dir) {
+			delete(w.names, name)
+		}
+	}
+	w.mu.Unlock()
+}
+
+// followRecursive keeps the recursive watches up to date with et, ets are et and the create events of the paths
+// found in a new directory, because they may be created before the new directory is watched.
+func (w fsnotifyWatcherWrapper) followRecursive(et fsnotify.Event) (ets []fsnotify.Event) {
+
+	ets = append(ets, et)
+	if et.Has(fsnotify.Remove) || et.Has(fsnotify.Rename) {
+		w.forgetNames(et.Name)
+		w.removeDirs(et.Name)
+		return
+	}
+	if !et.Has(fsnotify.Create) || !w.isBelowRecursive(et.Name) {
+		return
+	}
+	var stat, err = os.Lstat(et.Name)
+	if err != nil || !stat.IsDir() {
+		return
+	}
+	var found []string
+	if found, err = w.addDirsRecursive(et.Name); err != nil {
+		w.logHandler.Error("add new directory recursively fail, err: ", err)
+	}
+	for _, path := range found {
+		ets = append(ets, fsnotify.Event{Name: path, Op: fsnotify.Create})
+	}
+	return
+}
+
+// isPathBelow reports whether path is dir or below dir.
+func isPathBelow(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// isHiddenPath reports whether the name of path starts with a dot.
+func isHiddenPath(path string) bool { return strings.HasPrefix(filepath.Base(path), ".") }
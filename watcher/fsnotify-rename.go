@@ -0,0 +1,165 @@
+package watcher
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// renamePairWindow is how long a Rename event of fsnotify waits for the Create event of the new path.
+const renamePairWindow = 10 * time.Millisecond
+
+// fileIDs keeps the ids of the paths known by fsnotify, the old path of a Rename event does not exist anymore, so its
+// id is taken from the walks and the events before it.
+type fileIDs struct {
+	// mu protects ids.
+	mu  *sync.Mutex
+	ids map[string]fileIdentity
+}
+
+type fileIdentity struct {
+	id    fileID
+	isDir bool
+}
+
+func newFileIDs() *fileIDs {
+	return &fileIDs{mu: new(sync.Mutex), ids: make(map[string]fileIdentity, 64)}
+}
+
+// remember keeps the id of path of info if it is known.
+func (f *fileIDs) remember(path string, info fs.FileInfo) {
+
+	if id, isKnown := fileIDOf(info); isKnown {
+		f.mu.Lock()
+		f.ids[path] = fileIdentity{id: id, isDir: info.IsDir()}
+		f.mu.Unlock()
+	}
+}
+
+// rememberName keeps the ids of name and the paths directly in it, for a name added by AddPaths.
+func (f *fileIDs) rememberName(name string) {
+
+	var info, err = os.Lstat(name)
+	if err != nil {
+		return
+	}
+	f.remember(name, info)
+	if !info.IsDir() {
+		return
+	}
+	var entries, _ = os.ReadDir(name)
+	for _, entry := range entries {
+		if info, err = entry.Info(); err == nil {
+			f.remember(filepath.Join(name, entry.Name()), info)
+		}
+	}
+}
+
+// forget returns the id of path and forgets it, the paths below a directory are forgotten too.
+func (f *fileIDs) forget(path string) (id fileID, isKnown bool) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var identity fileIdentity
+	if identity, isKnown = f.ids[path]; !isKnown {
+		return
+	}
+	delete(f.ids, path)
+	if identity.isDir {
+		for below := range f.ids {
+			if isPathBelow(below, path) {
+				delete(f.ids, below)
+			}
+		}
+	}
+	return identity.id, true
+}
+
+// renamePairer pairs a Rename event of fsnotify with the Create event of the new path, fsnotify reports them in a row
+// when a path is renamed or moved inside the watched directories, but it does not expose the cookie pairing them.
+// They are paired only if the created path has the id of the renamed one, see fileIDs. A paired event has the new path
+// as Name, the old path as OldName, and Rename as op if the path stays in the same directory, or Move if not. A Rename
+// event not followed by the Create event of the same file in renamePairWindow, such as a path moved out of the watched
+// directories, is reported as it is.
+// renamePairer is not safe for concurrent use.
+type renamePairer struct {
+	ids       *fileIDs
+	pending   *fsnotify.Event
+	pendingID fileID
+	isKnown   bool // whether pendingID is known.
+	timer     *time.Timer
+}
+
+func newRenamePairer(ids *fileIDs) *renamePairer { return &renamePairer{ids: ids} }
+
+// pair takes et and returns the events ready to be handled.
+func (p *renamePairer) pair(et fsnotify.Event) (ets []Event) {
+
+	var id, isKnown = p.follow(et)
+	if p.pending != nil && et.Op == fsnotify.Create && isKnown && p.isKnown && id == p.pendingID {
+		var oldName = p.pending.Name
+		var op = Rename
+		if filepath.Dir(oldName) != filepath.Dir(et.Name) {
+			op = Move
+		}
+		p.stop()
+		return append(ets, newFsnotifyRenameEventWrapper(fsnotify.Event{Name: et.Name, Op: op}, oldName))
+	}
+	ets = p.flush()
+	if et.Op == fsnotify.Rename {
+		p.pending, p.pendingID, p.isKnown = &et, id, isKnown
+		p.timer = time.NewTimer(renamePairWindow)
+		return
+	}
+	return append(ets, newFsnotifyEventWrapper(et))
+}
+
+// follow keeps the ids up to date with et, id is the id of the path of et: the new one of a created path, or the last
+// one of a removed or renamed path.
+func (p *renamePairer) follow(et fsnotify.Event) (id fileID, isKnown bool) {
+
+	switch {
+	case et.Has(fsnotify.Create):
+		var info, err = os.Lstat(et.Name)
+		if err != nil {
+			return
+		}
+		p.ids.remember(et.Name, info)
+		return fileIDOf(info)
+	case et.Has(fsnotify.Remove) || et.Has(fsnotify.Rename):
+		return p.ids.forget(et.Name)
+	}
+	return
+}
+
+// flush returns the pending Rename event as it is.
+func (p *renamePairer) flush() (ets []Event) {
+
+	if p.pending != nil {
+		ets = append(ets, newFsnotifyEventWrapper(*p.pending))
+		p.stop()
+	}
+	return
+}
+
+// timeout returns a channel receiving when the pending Rename event should be flushed, nil if there is no pending event.
+func (p *renamePairer) timeout() <-chan time.Time {
+
+	if p.timer == nil {
+		return nil
+	}
+	return p.timer.C
+}
+
+func (p *renamePairer) stop() {
+
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.pending, p.isKnown, p.timer = nil, false, nil
+}
@@ -0,0 +1,27 @@
+//go:build darwin
+
+package watcher
+
+import "syscall"
+
+// _unreliableFSTypes are the names of the filesystems on which kqueue misses the changes made by other hosts or by a
+// user space daemon, see statfs(2).
+var _unreliableFSTypes = map[string]bool{"nfs": true, "smbfs": true, "afpfs": true, "webdav": true, "osxfuse": true, "macfuse": true}
+
+// unreliableFSType returns the type of the filesystem of path if fsnotify is known to be unreliable on it.
+func unreliableFSType(path string) (fsType string, isUnreliable bool) {
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return
+	}
+	var name = make([]byte, 0, len(stat.Fstypename))
+	for _, c := range stat.Fstypename {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+	fsType = string(name)
+	return fsType, _unreliableFSTypes[fsType]
+}
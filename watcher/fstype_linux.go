@@ -0,0 +1,29 @@
+//go:build linux
+
+package watcher
+
+import "syscall"
+
+// _unreliableFSTypes are the magic numbers of the filesystems on which inotify misses the changes made by other hosts,
+// by the host of a virtual machine or by a user space daemon, see statfs(2).
+var _unreliableFSTypes = map[uint32]string{
+	0x00006969: "nfs",
+	0x0000517b: "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x65735546: "fuse",
+	0x01021997: "9p",
+	0x786f4256: "vboxsf",
+	0x00c36400: "ceph",
+}
+
+// unreliableFSType returns the type of the filesystem of path if fsnotify is known to be unreliable on it.
+func unreliableFSType(path string) (fsType string, isUnreliable bool) {
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return
+	}
+	fsType, isUnreliable = _unreliableFSTypes[uint32(stat.Type)]
+	return
+}
@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+
+package watcher
+
+// unreliableFSType returns the type of the filesystem of path if fsnotify is known to be unreliable on it, no type is
+// known on this platform, so fsnotify is only given up when it fails.
+func unreliableFSType(path string) (fsType string, isUnreliable bool) { return }
@@ -0,0 +1,198 @@
+package watcher
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ignoreFileNames are the ignore files read in every directory, in the order of precedence, a rule of a later file
+// overrides the rules of the earlier files.
+var ignoreFileNames = []string{filepath.Join(".git", "info", "exclude"), ".gitignore", ".ignore"}
+
+// ignoreRecheckInterval is how often the ignore files of a directory are checked for changes when they are not
+// reported by an event, e.g. .git/info/exclude which is below the always ignored .git directory.
+const ignoreRecheckInterval = time.Second
+
+// ignoreRule is a line of an ignore file, see https://git-scm.com/docs/gitignore.
+type ignoreRule struct {
+	pattern string // glob relative to the directory of the ignore file, see matchGlob.
+	negate  bool
+	dirOnly bool
+}
+
+func (r ignoreRule) match(rel string, isDir bool) bool {
+	return (isDir || !r.dirOnly) && matchGlob(r.pattern, rel)
+}
+
+// parseIgnoreRules parses the content of an ignore file, the malformed patterns are skipped.
+func parseIgnoreRules(data []byte) (rules []ignoreRule) {
+
+	for _, line := range strings.Split(string(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))), "\n") {
+		if line = strings.TrimRight(line, " \t"); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule ignoreRule
+		if rule.negate = strings.HasPrefix(line, "!"); rule.negate {
+			line = line[1:]
+		}
+		// a backslash escapes a leading "!" or "#".
+		if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if rule.dirOnly = strings.HasSuffix(line, "/"); rule.dirOnly {
+			line = strings.TrimRight(line, "/")
+		}
+		// a pattern with a slash is anchored to the directory of the ignore file, otherwise it matches at any level.
+		if strings.Contains(line, "/") {
+			line = strings.TrimPrefix(line, "/")
+		} else {
+			line = "**/" + line
+		}
+		if line == "" || line == "**/" {
+			continue
+		}
+		var isValid = true
+		for _, segment := range strings.Split(line, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				isValid = false
+				break
+			}
+		}
+		if isValid {
+			rule.pattern = line
+			rules = append(rules, rule)
+		}
+	}
+	return
+}
+
+// gitIgnore matches the paths below a watched root by the ignore files of the root and the directories below it, the
+// ignore files above the root are not read. The .git directories are always ignored. The rules of a directory are read
+// lazily and cached, and read again when invalidate is called with an ignore file or a change is found by rechecking.
+type gitIgnore struct {
+	// mu protects dirs.
+	mu   *sync.Mutex
+	dirs map[string]*ignoreDir
+}
+
+type ignoreDir struct {
+	rules     []ignoreRule
+	stamps    []ignoreStamp // stamps of ignoreFileNames in order.
+	checkedAt time.Time
+}
+
+// ignoreStamp identifies a version of an ignore file, it is zero if the file does not exist.
+type ignoreStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func newGitIgnore() *gitIgnore {
+	return &gitIgnore{mu: new(sync.Mutex), dirs: make(map[string]*ignoreDir, 8)}
+}
+
+// isIgnored reports whether path below root is ignored, a path is ignored if it or any directory between root and it
+// is ignored, because git can not re-include a file if its parent directory is excluded.
+func (g *gitIgnore) isIgnored(root, path string, isDir bool) bool {
+
+	var rel, err = filepath.Rel(root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	var segments = strings.Split(filepath.ToSlash(rel), "/")
+	for i := range segments {
+		if g.isIgnoredAt(root, segments[:i+1], isDir || i < len(segments)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// isIgnoredAt reports whether the path of segments below root is ignored by the rules of root and the directories
+// between root and it, the last matching rule wins.
+func (g *gitIgnore) isIgnoredAt(root string, segments []string, isDir bool) (isIgnored bool) {
+
+	if isDir && segments[len(segments)-1] == ".git" {
+		return true
+	}
+	var dir = root
+	for i := range segments {
+		if i > 0 {
+			dir = filepath.Join(dir, segments[i-1])
+		}
+		var rel = strings.Join(segments[i:], "/")
+		for _, rule := range g.rulesOf(dir) {
+			if rule.match(rel, isDir) {
+				isIgnored = !rule.negate
+			}
+		}
+	}
+	return
+}
+
+// rulesOf returns the rules of the ignore files in dir.
+func (g *gitIgnore) rulesOf(dir string) []ignoreRule {
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var cached = g.dirs[dir]
+	if cached != nil && time.Since(cached.checkedAt) < ignoreRecheckInterval {
+		return cached.rules
+	}
+	var stamps = make([]ignoreStamp, len(ignoreFileNames))
+	for i, name := range ignoreFileNames {
+		if stat, err := os.Stat(filepath.Join(dir, name)); err == nil && !stat.IsDir() {
+			stamps[i] = ignoreStamp{modTime: stat.ModTime(), size: stat.Size()}
+		}
+	}
+	if cached != nil && equalStamps(cached.stamps, stamps) {
+		cached.checkedAt = time.Now()
+		return cached.rules
+	}
+	cached = &ignoreDir{stamps: stamps, checkedAt: time.Now()}
+	for i, name := range ignoreFileNames {
+		if stamps[i] == (ignoreStamp{}) {
+			continue
+		}
+		// a file removed after stat is treated as empty, it is read again by the next check.
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err == nil {
+			cached.rules = append(cached.rules, parseIgnoreRules(data)...)
+		}
+	}
+	g.dirs[dir] = cached
+	return cached.rules
+}
+
+// invalidate drops the cached rules of dir if path is an ignore file of dir, isIgnoreFile reports whether it is.
+func (g *gitIgnore) invalidate(path string) (dir string, isIgnoreFile bool) {
+
+	for _, name := range ignoreFileNames {
+		if strings.HasSuffix(path, string(filepath.Separator)+name) {
+			dir = strings.TrimSuffix(path, string(filepath.Separator)+name)
+			g.mu.Lock()
+			delete(g.dirs, dir)
+			g.mu.Unlock()
+			return dir, true
+		}
+	}
+	return
+}
+
+func equalStamps(a, b []ignoreStamp) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].modTime.Equal(b[i].modTime) || a[i].size != b[i].size {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTree writes files into dir, the parent directories are created.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+
+	for name, content := range files {
+		var path = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGitIgnore(t *testing.T) {
+
+	var root = t.TempDir()
+	writeTree(t, root, map[string]string{
+		".gitignore":        "# comment\n*.log\n!keep.log\n/build\nout/\n",
+		".git/info/exclude": "secret.txt\n",
+		"sub/.gitignore":    "/local.txt\n!*.log\n",
+		"sub/.ignore":       "tmp/\n",
+	})
+	var g = newGitIgnore()
+	for name, expected := range map[string]bool{
+		"a.txt":          false,
+		"a.log":          true,
+		"keep.log":       false,
+		"build":          true,
+		"sub/build":      false,
+		"out":            true,
+		"x/out/y.txt":    true,
+		"secret.txt":     true,
+		"sub/local.txt":  true,
+		"local.txt":      false,
+		"sub/a.log":      false,
+		"sub/tmp/a.txt":  true,
+		".git/config":    true,
+		"sub/.gitignore": false,
+	} {
+		var path = filepath.Join(root, filepath.FromSlash(name))
+		if isIgnored := g.isIgnored(root, path, name == "build" || name == "sub/build" || name == "out"); isIgnored != expected {
+			t.Errorf("expected %s to be ignored %t, got %t", name, expected, isIgnored)
+		}
+	}
+	// the rules are read again after the ignore file is changed.
+	writeTree(t, root, map[string]string{".gitignore": "*.txt\n"})
+	if _, isIgnoreFile := g.invalidate(filepath.Join(root, ".gitignore")); !isIgnoreFile {
+		t.Error("expected .gitignore to be an ignore file")
+	}
+	if !g.isIgnored(root, filepath.Join(root, "a.txt"), false) || g.isIgnored(root, filepath.Join(root, "a.log"), false) {
+		t.Error("expected the changed rules to be used")
+	}
+}
+
+func TestGitIgnoreBackends(t *testing.T) {
+
+	for _, backend := range []Backend{BackendFsnotify, BackendRadovskybwatcher} {
+		t.Run(string(backend), func(t *testing.T) {
+			var testDir = t.TempDir()
+			writeTree(t, testDir, map[string]string{
+				".gitignore":            "node_modules/\n*.log\n",
+				"node_modules/dep/a.js": "a",
+				".git/HEAD":             "a",
+				"src/main.go":           "a",
+			})
+			var collector = new(eventCollector)
+			var w, err = New(backend, WithGitIgnore(true), WithPollInterval(20*time.Millisecond), WithHandlers(collector))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+			if err = w.AddRecursive(testDir); err != nil {
+				t.Fatal(err)
+			}
+			var kept = filepath.Join(testDir, "src", "b.go")
+			writeTree(t, testDir, map[string]string{
+				"node_modules/dep/b.js": "a",
+				".git/index":            "a",
+				"src/a.log":             "a",
+				"src/b.go":              "a",
+			})
+			if !collector.waitFor(kept, Create, time.Second) {
+				t.Errorf("expected create event of %s", kept)
+			}
+			time.Sleep(50 * time.Millisecond)
+			collector.mu.Lock()
+			for _, et := range collector.events {
+				if et.Name() != kept && et.Name() != testDir && et.Name() != filepath.Dir(kept) {
+					t.Errorf("expected the event to be ignored, got %s", et)
+				}
+			}
+			collector.mu.Unlock()
+			// the log files are not ignored after .gitignore is changed.
+			writeTree(t, testDir, map[string]string{".gitignore": "node_modules/\n"})
+			time.Sleep(50 * time.Millisecond)
+			var log = filepath.Join(testDir, "src", "b.log")
+			writeTree(t, testDir, map[string]string{"src/b.log": "a"})
+			if !collector.waitFor(log, Create, time.Second) {
+				t.Errorf("expected create event of %s", log)
+			}
+		})
+	}
+}
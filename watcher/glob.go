@@ -0,0 +1,135 @@
+package watcher
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// GlobFilter includes and excludes paths by glob patterns matched against the path relative to its watched root, with
+// '/' as the separator on all platforms. A pattern supports the syntax of [path.Match] in a path segment, and "**" as a
+// whole segment matching zero or more segments, e.g. "**/*.go" matches all go files and "vendor/**" matches vendor and
+// all paths below it. A pattern starting with "!" excludes the paths it matches.
+//
+// An excluded directory is not walked when adding watches, and the events of the excluded paths are dropped. If there
+// is any include pattern, the files and directories not matching them are dropped too, but a directory not matching
+// them is still walked so the files below it can be included.
+type GlobFilter struct {
+	includes []string
+	excludes []string
+}
+
+// NewGlobFilter compiles patterns, it returns path.ErrBadPattern if a pattern is malformed.
+func NewGlobFilter(patterns ...string) (f *GlobFilter, err error) {
+
+	f = new(GlobFilter)
+	for _, pattern := range patterns {
+		var isExclude = strings.HasPrefix(pattern, "!")
+		pattern = strings.Trim(filepath.ToSlash(strings.TrimPrefix(pattern, "!")), "/")
+		for _, segment := range strings.Split(pattern, "/") {
+			if _, err = path.Match(segment, ""); err != nil {
+				err = errors.WithMessage(err, pattern)
+				return nil, err
+			}
+		}
+		if isExclude {
+			f.excludes = append(f.excludes, pattern)
+		} else {
+			f.includes = append(f.includes, pattern)
+		}
+	}
+	return
+}
+
+// Match reports whether rel, the path relative to its watched root, is kept by the filter, the root itself is always kept.
+func (f *GlobFilter) Match(rel string) (isKept bool) {
+
+	if rel = filepath.ToSlash(rel); rel == "." || rel == "" {
+		return true
+	}
+	if f.IsExcluded(rel) {
+		return false
+	}
+	if len(f.includes) == 0 {
+		return true
+	}
+	for _, pattern := range f.includes {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExcluded reports whether rel matches an exclude pattern, an excluded directory should not be walked. The root itself
+// is never excluded.
+func (f *GlobFilter) IsExcluded(rel string) bool {
+
+	if rel = filepath.ToSlash(rel); rel == "." || rel == "" {
+		return false
+	}
+	for _, pattern := range f.excludes {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob reports whether the '/' separated name matches pattern with "**" support, pattern must be valid.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(patterns, names []string) bool {
+
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			// collapse "**/**" and try to match the rest at every position.
+			for len(patterns) > 0 && patterns[0] == "**" {
+				patterns = patterns[1:]
+			}
+			if len(patterns) == 0 {
+				return true
+			}
+			for i := 0; i <= len(names); i++ {
+				if matchSegments(patterns, names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return false
+		}
+		if isMatched, _ := path.Match(patterns[0], names[0]); !isMatched {
+			return false
+		}
+		patterns, names = patterns[1:], names[1:]
+	}
+	return len(names) == 0
+}
+
+// relToRoots returns path relative to the longest root containing it, isFound is false if there is no such root.
+func relToRoots(path string, roots []string) (rel string, isFound bool) {
+
+	var root string
+	if root, isFound = rootOf(path, roots); !isFound {
+		return
+	}
+	rel, err := filepath.Rel(root, path)
+	return rel, err == nil
+}
+
+// rootOf returns the longest root containing path, isFound is false if there is no such root.
+func rootOf(path string, roots []string) (root string, isFound bool) {
+
+	for _, r := range roots {
+		if len(r) > len(root) && isPathBelow(path, r) {
+			root = r
+		}
+	}
+	return root, root != ""
+}
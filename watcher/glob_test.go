@@ -0,0 +1,93 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGlobFilterMatch(t *testing.T) {
+
+	var f, err = NewGlobFilter("**/*.go", "!vendor/**", "!**/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rel, expected := range map[string]bool{
+		".":                        true,
+		"main.go":                  true,
+		"a/b/c.go":                 true,
+		"a/b/c.txt":                false,
+		"vendor":                   false,
+		"vendor/x/y.go":            false,
+		"a/testdata":               false,
+		"a/testdata.go":            true,
+		filepath.Join("a", "b.go"): true,
+	} {
+		if isKept := f.Match(rel); isKept != expected {
+			t.Errorf("expected Match(%q) to be %t, got %t", rel, expected, isKept)
+		}
+	}
+	if _, err = NewGlobFilter("a/[b"); err == nil {
+		t.Error("expected error of a malformed pattern")
+	}
+}
+
+func TestGlobFilterBackends(t *testing.T) {
+
+	for _, backend := range []Backend{BackendFsnotify, BackendRadovskybwatcher} {
+		t.Run(string(backend), func(t *testing.T) {
+			var testDir = t.TempDir()
+			for _, dir := range []string{"src", "vendor"} {
+				if err := os.Mkdir(filepath.Join(testDir, dir), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var f, err = NewGlobFilter("**/*.go", "!vendor/**")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var collector = new(eventCollector)
+			w, err := New(backend, WithGlobFilter(f), WithPollInterval(20*time.Millisecond), WithHandlers(collector))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+			if err = w.AddRecursive(testDir); err != nil {
+				t.Fatal(err)
+			}
+			var skipped = []string{filepath.Join(testDir, "src", "a.txt"), filepath.Join(testDir, "vendor", "b.go")}
+			var kept = filepath.Join(testDir, "src", "a.go")
+			for _, path := range append(skipped, kept) {
+				if err = os.WriteFile(path, []byte("a"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !collector.waitFor(kept, Create, time.Second) {
+				t.Errorf("expected create event of %s", kept)
+			}
+			// a new directory not included is still walked for the files below it.
+			var lib = filepath.Join(testDir, "lib")
+			if err = os.Mkdir(lib, 0755); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(50 * time.Millisecond)
+			var libFile = filepath.Join(lib, "c.go")
+			if err = os.WriteFile(libFile, []byte("a"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if !collector.waitFor(libFile, Create, time.Second) {
+				t.Errorf("expected create event of %s", libFile)
+			}
+			time.Sleep(50 * time.Millisecond)
+			collector.mu.Lock()
+			defer collector.mu.Unlock()
+			for _, et := range collector.events {
+				// the root itself is always kept.
+				if et.Name() != kept && et.Name() != libFile && et.Name() != testDir {
+					t.Errorf("expected the event to be filtered, got %s", et)
+				}
+			}
+		})
+	}
+}
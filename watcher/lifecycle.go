@@ -0,0 +1,147 @@
+package watcher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultShutdownTimeout is how long Run drains the queued events after its context is done if it is not set by
+// WithShutdownTimeout.
+const DefaultShutdownTimeout = 5 * time.Second
+
+// ErrBackendClosed is the terminal error when the backend stops without Close or Shutdown being called.
+var ErrBackendClosed = errors.New("error: backend of watcher was closed")
+
+// lifecycle stops the backend and the dispatcher of a watcher, an event loop of the backend must be counted by loops and
+// call loopExit when it returns, and waitLoops must be called after all event loops are started.
+type lifecycle struct {
+	stopBackend     func() (err error)
+	shutdownTimeout time.Duration
+	stopOnce        *sync.Once
+	stopErr         error
+	stopping        chan struct{} // closed when Close or Shutdown is called.
+	loops           *sync.WaitGroup
+	loopDone        chan struct{} // closed when all event loops return.
+	// mu protects the following.
+	mu          *sync.Mutex
+	terminalErr error
+}
+
+func newLifecycle(shutdownTimeout time.Duration) lifecycle {
+
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = DefaultShutdownTimeout
+	}
+	return lifecycle{
+		shutdownTimeout: shutdownTimeout,
+		stopOnce:        new(sync.Once),
+		stopping:        make(chan struct{}),
+		loops:           new(sync.WaitGroup),
+		loopDone:        make(chan struct{}),
+		mu:              new(sync.Mutex),
+	}
+}
+
+// stop stops the backend once, the event loop returns after it.
+func (c *watcherCore) stop() (err error) {
+
+	c.stopOnce.Do(func() {
+		close(c.stopping)
+		if c.stopBackend != nil {
+			c.stopErr = c.stopBackend()
+		}
+	})
+	return c.stopErr
+}
+
+// loopExit is deferred by an event loop of the backend, the queued events are still handled after it.
+func (c *watcherCore) loopExit() {
+
+	select {
+	case <-c.stopping:
+	default:
+		c.mu.Lock()
+		c.terminalErr = ErrBackendClosed
+		c.mu.Unlock()
+		c.logHandler.Error(ErrBackendClosed)
+		// the other event loops of a hybrid watcher are stopped too.
+		go c.stop()
+	}
+	c.loops.Done()
+}
+
+// waitLoops drains the dispatcher after all event loops return.
+func (c *watcherCore) waitLoops() {
+
+	go func() {
+		c.loops.Wait()
+		close(c.loopDone)
+		c.dispatcher.drain()
+	}()
+}
+
+func (c *watcherCore) getTerminalErr() (err error) {
+
+	c.mu.Lock()
+	err = c.terminalErr
+	c.mu.Unlock()
+	return
+}
+
+// Close stops the watcher at once, the queued events are dropped and it does not wait for the running handlers.
+func (c *watcherCore) Close() (err error) {
+
+	err = c.stop()
+	c.dispatcher.close()
+	return
+}
+
+// Shutdown stops the backend, then waits until the queued events are handled and all goroutines of the watcher return,
+// if ctx is done before that, the events left are dropped and the error of ctx is returned. It returns the terminal
+// error of the watcher otherwise.
+func (c *watcherCore) Shutdown(ctx context.Context) (err error) {
+
+	var stopped = make(chan error, 1)
+	go func() { stopped <- c.stop() }()
+	select {
+	case <-c.loopDone:
+	case <-ctx.Done():
+		c.dispatcher.close()
+		return errors.WithStack(ctx.Err())
+	}
+	select {
+	case <-c.dispatcher.done:
+	case <-ctx.Done():
+		c.dispatcher.close()
+		return errors.WithStack(ctx.Err())
+	}
+	select {
+	case err = <-stopped:
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+	if err == nil {
+		err = c.getTerminalErr()
+	}
+	return
+}
+
+// Run blocks until ctx is done or the watcher stops. When ctx is done, it shuts the watcher down with the timeout set by
+// WithShutdownTimeout and returns the error of Shutdown, it returns nil if the watcher shuts down in time. When the
+// watcher is stopped by Close, Shutdown or its backend, it waits for the queued events to be handled and returns the
+// terminal error of the watcher, which is nil if the watcher is stopped by Close or Shutdown.
+func (c *watcherCore) Run(ctx context.Context) (err error) {
+
+	select {
+	case <-ctx.Done():
+		var shutdownCtx, cancel = context.WithTimeout(context.Background(), c.shutdownTimeout)
+		defer cancel()
+		return c.Shutdown(shutdownCtx)
+	case <-c.loopDone:
+		<-c.dispatcher.done
+		return c.getTerminalErr()
+	}
+}
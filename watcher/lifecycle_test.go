@@ -0,0 +1,153 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowHandler sleeps before collecting an event.
+type slowHandler struct {
+	eventCollector
+	delay time.Duration
+}
+
+func (h *slowHandler) FSHandle(event Event) {
+	time.Sleep(h.delay)
+	h.eventCollector.FSHandle(event)
+}
+
+func TestRunDrainsQueuedEvents(t *testing.T) {
+
+	var testDir = t.TempDir()
+	var handler = &slowHandler{delay: 20 * time.Millisecond}
+	var dispatched atomic.Int64
+	w, err := New(BackendFsnotify, WithHandlers(handler), WithEventHook(func(etIn Event) (Event, bool) {
+		dispatched.Add(1)
+		return etIn, false
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.AddPaths(testDir); err != nil {
+		t.Fatal(err)
+	}
+	var ctx, cancel = context.WithCancel(context.Background())
+	var runErr = make(chan error, 1)
+	go func() { runErr <- w.Run(ctx) }()
+	for i := 0; i < 5; i++ {
+		if err = os.WriteFile(filepath.Join(testDir, strconv.Itoa(i)), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !handler.waitFor(filepath.Join(testDir, "0"), Create, time.Second) {
+		t.Fatal("expected the first event to be handled")
+	}
+	cancel()
+	select {
+	case err = <-runErr:
+		if err != nil {
+			t.Fatalf("expected Run to return nil, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected Run to return")
+	}
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if int64(len(handler.events)) != dispatched.Load() {
+		t.Errorf("expected all %d dispatched events to be handled, got %d", dispatched.Load(), len(handler.events))
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+
+	var testDir = t.TempDir()
+	var handler = &blockingHandler{release: make(chan struct{})}
+	w, err := New(BackendRadovskybwatcher, WithHandlers(handler), WithPollInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.AddPaths(testDir); err != nil {
+		t.Fatal(err)
+	}
+	var runErr = make(chan error, 1)
+	go func() { runErr <- w.Run(context.Background()) }()
+	if err = os.WriteFile(filepath.Join(testDir, "file.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	var ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err = w.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	// Run waits for the running handler.
+	close(handler.release)
+	select {
+	case err = <-runErr:
+		if err != nil {
+			t.Fatalf("expected Run to return nil after Shutdown, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Run to return after Shutdown")
+	}
+}
+
+func TestEventsAndErrorsChan(t *testing.T) {
+
+	var testDir = t.TempDir()
+	var handler = new(errorHandler)
+	w, err := New(BackendFsnotify, WithHandlers(handler), WithEventsBuffer(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events, errs = w.Events(), w.Errors()
+	if err = w.AddPaths(testDir); err != nil {
+		t.Fatal(err)
+	}
+	var file = filepath.Join(testDir, "file.txt")
+	if err = os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case et := <-events:
+		if et.Name() != file || !et.Has(Create) {
+			t.Errorf("expected create event of %s, got %s", file, et)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected an event from Events")
+	}
+	select {
+	case err = <-errs:
+		var herr *HandlerError
+		if !errors.As(err, &herr) {
+			t.Errorf("expected *HandlerError, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected an error from Errors")
+	}
+	if !handler.waitFor(file, Create, time.Second) {
+		t.Error("expected the handler to receive the event too")
+	}
+	w.Close()
+	var timeout = time.After(time.Second)
+	for events != nil || errs != nil {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+			}
+		case _, ok := <-errs:
+			if !ok {
+				errs = nil
+			}
+		case <-timeout:
+			t.Fatal("expected Events and Errors to be closed")
+		}
+	}
+}
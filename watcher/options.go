@@ -0,0 +1,209 @@
+package watcher
+
+import (
+	"hash"
+	"time"
+
+	logger "github.com/xiaoyang-chen/file-watcher/logger"
+	radovskybwatcher "github.com/xiaoyang-chen/file-watcher/radovskyb-watcher"
+)
+
+// DefaultChanBuffer is the buffer size of Watcher.Events and Watcher.Errors if it is not set by WithEventsBuffer and
+// WithErrorsBuffer.
+const DefaultChanBuffer = 64
+
+// DefaultPollInterval is the sleep time between two scans of the polling backend if it is not set by WithPollInterval.
+const DefaultPollInterval = time.Second
+
+// Option configures a watcher created by New.
+type Option func(o *options)
+
+type options struct {
+	logHandler        logger.Logger
+	eventHook         EventHookFunc
+	pipeline          *Pipeline
+	handlers          []FSEventHandler
+	errorHandler      ErrorHandlerFunc
+	handlerDefaults   handlerConfig
+	shutdownTimeout   time.Duration
+	eventsBuffer      int
+	errorsBuffer      int
+	pollInterval      time.Duration
+	ignoreHidden      bool
+	globFilter        *GlobFilter
+	gitIgnore         bool
+	reconcile         bool
+	reconcileInterval time.Duration
+	maxEvents         int
+	snapshotPath      string
+	snapshotInterval  time.Duration
+	contentHash       radovskybwatcher.HashConfig
+	childMoves        bool
+	fullScanInterval  time.Duration
+	walkers           int
+	adaptiveInterval  radovskybwatcher.AdaptiveInterval
+	ops               []Op
+}
+
+func newOptions(opts []Option) (o *options) {
+
+	o = &options{pollInterval: DefaultPollInterval, eventsBuffer: DefaultChanBuffer, errorsBuffer: DefaultChanBuffer}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.logHandler == nil {
+		o.logHandler = logger.NewNoop()
+	}
+	if o.pipeline == nil {
+		o.pipeline = NewPipeline()
+	}
+	return
+}
+
+// WithLogger sets the logger of the watcher, the default logger discards all logs.
+func WithLogger(logHandler logger.Logger) Option {
+	return func(o *options) { o.logHandler = logHandler }
+}
+
+// WithEventHook sets the hook called before the events are dispatched to the handlers.
+func WithEventHook(eventHook EventHookFunc) Option {
+	return func(o *options) { o.eventHook = eventHook }
+}
+
+// WithPipeline sets the pipeline run after the event hook, an empty pipeline is used by default.
+func WithPipeline(pipeline *Pipeline) Option {
+	return func(o *options) { o.pipeline = pipeline }
+}
+
+// WithHandlers appends the handlers receiving the events, use ConfigureHandler to set the options of a handler.
+func WithHandlers(fsEventHandlers ...FSEventHandler) Option {
+	return func(o *options) { o.handlers = append(o.handlers, fsEventHandlers...) }
+}
+
+// WithErrorHandler sets the receiver of the errors of the watcher, see Watcher.SetErrorHandler.
+func WithErrorHandler(errorHandler ErrorHandlerFunc) Option {
+	return func(o *options) { o.errorHandler = errorHandler }
+}
+
+// WithQueueSize sets the default queue size of the handlers, see HandlerQueueSize.
+func WithQueueSize(size int) Option {
+	return func(o *options) { o.handlerDefaults.queueSize = size }
+}
+
+// WithOverflowPolicy sets the default overflow policy of the handlers, see HandlerOverflow.
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(o *options) { o.handlerDefaults.overflow = policy }
+}
+
+// WithShutdownTimeout sets how long Run drains the queued events after its context is done, see DefaultShutdownTimeout.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(o *options) { o.shutdownTimeout = timeout }
+}
+
+// WithEventsBuffer sets the buffer size of Watcher.Events, see DefaultChanBuffer.
+func WithEventsBuffer(size int) Option {
+	return func(o *options) { o.eventsBuffer = size }
+}
+
+// WithErrorsBuffer sets the buffer size of Watcher.Errors, see DefaultChanBuffer.
+func WithErrorsBuffer(size int) Option {
+	return func(o *options) { o.errorsBuffer = size }
+}
+
+// WithPollInterval sets the sleep time between two scans of the polling backend, it will run cyclically as
+// "scan -> sleep(interval) -> scan -> ...". Only for the polling backend, including the paths polled by BackendHybrid.
+func WithPollInterval(interval time.Duration) Option {
+	return func(o *options) { o.pollInterval = interval }
+}
+
+// WithIgnoreHidden ignores the files and directories those are hidden, a hidden directory is not walked by AddRecursive.
+// The fsnotify backend treats the names starting with a dot as hidden, the polling backend also uses the hidden
+// attribute on windows.
+func WithIgnoreHidden(ignore bool) Option {
+	return func(o *options) { o.ignoreHidden = ignore }
+}
+
+// WithGlobFilter filters the watched paths and their events by f, see GlobFilter.
+func WithGlobFilter(f *GlobFilter) Option {
+	return func(o *options) { o.globFilter = f }
+}
+
+// WithGitIgnore ignores the paths matched by the .gitignore, .ignore and .git/info/exclude files of the watched roots
+// and the directories below them, with the negation and anchoring semantics of git, and the .git directories. An
+// ignored directory is not walked, and the rules are read again when an ignore file changes.
+func WithGitIgnore(use bool) Option {
+	return func(o *options) { o.gitIgnore = use }
+}
+
+// WithReconcile keeps a snapshot of the paths watched by fsnotify, including the paths watched by fsnotify of
+// BackendHybrid, and scans them when fsnotify reports fsnotify.ErrEventOverflow and every interval if it is greater than
+// 0. A scan synthesizes the Create, Write and Remove events missed since the last scan, see IsReconciled. The scan runs
+// in the event loop, so the events of the backend wait for it, and the snapshot holds the state of every watched path.
+func WithReconcile(interval time.Duration) Option {
+	return func(o *options) { o.reconcile, o.reconcileInterval = true, interval }
+}
+
+// WithMaxEvents sets the maximum amount of events sent per scan, if it is less than 1, there is no limit, which is the
+// default. Only for the polling backend, including the paths polled by BackendHybrid.
+func WithMaxEvents(maxEvents int) Option {
+	return func(o *options) { o.maxEvents = maxEvents }
+}
+
+// WithSnapshot saves the files scanned by the polling backend to path when the watcher is closed and every interval if
+// it is greater than 0, and loads it when the watcher is created, so the first scan of a path added again reports the
+// changes made while the watcher was not running. An error of loading it fails New, an error of saving it is reported
+// to the error handler. Only for the polling backend, including the paths polled by BackendHybrid.
+func WithSnapshot(path string, interval time.Duration) Option {
+	return func(o *options) { o.snapshotPath, o.snapshotInterval = path, interval }
+}
+
+// WithContentHash compares the content of the files by the sum of newHash, e.g. sha256.New, so a file touched without
+// changing its content is not reported as Write, and a write keeping the size within the granularity of the
+// modification time is found, see ContentHash. The files larger than maxSize are compared by the modification time and
+// the size, 0 means no limit. If onlyIfMetadataChanged is true, a file is read only if its modification time or size
+// changed. Only for the polling backend, including the paths polled by BackendHybrid.
+func WithContentHash(newHash func() hash.Hash, maxSize int64, onlyIfMetadataChanged bool) Option {
+	return func(o *options) {
+		o.contentHash = radovskybwatcher.HashConfig{New: newHash, MaxSize: maxSize, OnlyIfMetadataChanged: onlyIfMetadataChanged}
+	}
+}
+
+// WithChildMoves reports a Move event for every path below a moved directory, only the Rename or Move event of the
+// directory itself is reported by default. Only for the polling backend, including the paths polled by BackendHybrid.
+func WithChildMoves(report bool) Option {
+	return func(o *options) { o.childMoves = report }
+}
+
+// WithIncrementalScan scans incrementally if fullScanInterval is greater than 0: the files of a directory whose
+// modification time and entry count did not change are taken from the last scan without stating them. A write or a
+// chmod does not change the directory of a file, so it is found by the full scan listing every directory once every
+// fullScanInterval. See ScanStatsReporter for the counters. Only for the polling backend, including the paths polled by
+// BackendHybrid.
+func WithIncrementalScan(fullScanInterval time.Duration) Option {
+	return func(o *options) { o.fullScanInterval = fullScanInterval }
+}
+
+// WithWalkers sets the maximum number of goroutines walking the directories of a path added by AddRecursive and by
+// each scan, n less than 1 means runtime.GOMAXPROCS(0), which is the default. Only for the polling backend, including
+// the paths polled by BackendHybrid.
+func WithWalkers(n int) Option {
+	return func(o *options) { o.walkers = n }
+}
+
+// WithAdaptivePollInterval makes the sleep between two scans adaptive: it is min after a scan finding changes, and it
+// doubles after each idle scan up to max, it does not back off if max is not greater than 0. The sleep is long enough
+// that the scans take at most maxScanFraction of the wall time, even if it is longer than max, 0 means no limit. The
+// interval of WithPollInterval is used as min if min is not greater than 0. Only for the polling backend, including the
+// paths polled by BackendHybrid.
+func WithAdaptivePollInterval(min, max time.Duration, maxScanFraction float64) Option {
+	return func(o *options) {
+		o.adaptiveInterval = radovskybwatcher.AdaptiveInterval{Min: min, Max: max, MaxScanFraction: maxScanFraction}
+	}
+}
+
+// WithOps sets the ops those will only be received, all ops are received if ops is empty. The other ops are removed
+// from an event before the event hook, and an event without any of ops is dropped, see HandlerOps for a handler. The
+// polling backend also filters them before they are counted by WithMaxEvents.
+func WithOps(ops ...Op) Option {
+	return func(o *options) { o.ops = ops }
+}
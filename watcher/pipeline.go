@@ -0,0 +1,176 @@
+package watcher
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// StageFunc is a stage of a Pipeline, it calls emit 0 or more times with the events passed to the next stage, so it can
+// transform, skip, split into several events, or annotate et by Event.WithValue.
+type StageFunc func(et Event, emit func(Event))
+
+// StageStats is the runtime information of a stage, see Pipeline.Stages.
+type StageStats struct {
+	Name string
+	In   uint64 // the events passed to the stage.
+	Out  uint64 // the events emitted by the stage.
+}
+
+// Pipeline is an ordered chain of stages run before the events are dispatched to the handlers, see WithPipeline.
+// The stages can be changed and inspected at runtime, it is safe for concurrent use.
+type Pipeline struct {
+	mu     *sync.RWMutex
+	stages []*pipelineStage
+}
+
+type pipelineStage struct {
+	name string
+	f    StageFunc
+	in   *atomic.Uint64
+	out  *atomic.Uint64
+}
+
+// NewPipeline returns an empty Pipeline, add stages by Use and UseHook.
+func NewPipeline() *Pipeline { return &Pipeline{mu: new(sync.RWMutex)} }
+
+// Chain returns a Pipeline running hooks in order, the stages are named "hook-0", "hook-1" and so on.
+func Chain(hooks ...EventHookFunc) (p *Pipeline) {
+
+	p = NewPipeline()
+	for i, hook := range hooks {
+		p.UseHook("hook-"+strconv.Itoa(i), hook)
+	}
+	return
+}
+
+// Use appends a stage named name, the names are used by Remove and Stages and they should be unique.
+func (p *Pipeline) Use(name string, f StageFunc) *Pipeline {
+
+	p.mu.Lock()
+	p.stages = append(p.stages, &pipelineStage{name: name, f: f, in: new(atomic.Uint64), out: new(atomic.Uint64)})
+	p.mu.Unlock()
+	return p
+}
+
+// UseHook appends hook as a stage named name, see HookStage.
+func (p *Pipeline) UseHook(name string, hook EventHookFunc) *Pipeline {
+	return p.Use(name, HookStage(hook))
+}
+
+// Remove removes the stage named name, isRemoved is false if there is no such stage.
+func (p *Pipeline) Remove(name string) (isRemoved bool) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, stage := range p.stages {
+		if stage.name == name {
+			p.stages = append(p.stages[:i:i], p.stages[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Stages returns the stages in order with their counters.
+func (p *Pipeline) Stages() (stats []StageStats) {
+
+	p.mu.RLock()
+	stats = make([]StageStats, 0, len(p.stages))
+	for _, stage := range p.stages {
+		stats = append(stats, StageStats{Name: stage.name, In: stage.in.Load(), Out: stage.out.Load()})
+	}
+	p.mu.RUnlock()
+	return
+}
+
+// Process runs et through all stages and returns the events emitted by the last stage.
+func (p *Pipeline) Process(et Event) (ets []Event) {
+
+	p.mu.RLock()
+	var stages = p.stages
+	p.mu.RUnlock()
+	ets = []Event{et}
+	for _, stage := range stages {
+		var outs = make([]Event, 0, len(ets))
+		var emit = func(out Event) {
+			stage.out.Add(1)
+			outs = append(outs, out)
+		}
+		for _, in := range ets {
+			stage.in.Add(1)
+			stage.f(in, emit)
+		}
+		if ets = outs; len(ets) == 0 {
+			break
+		}
+	}
+	return
+}
+
+// HookStage adapts hook to a stage, the event is skipped if hook returns isSkip.
+func HookStage(hook EventHookFunc) StageFunc {
+
+	return func(et Event, emit func(Event)) {
+		if out, isSkip := hook(et); !isSkip {
+			emit(out)
+		}
+	}
+}
+
+// PathPrefixStage keeps the events whose path is one of prefixes or below one of them.
+func PathPrefixStage(prefixes ...string) StageFunc {
+
+	return func(et Event, emit func(Event)) {
+		for _, prefix := range prefixes {
+			if isPathBelow(et.Name(), prefix) {
+				emit(et)
+				return
+			}
+		}
+	}
+}
+
+// OpStage keeps the events having any op of mask, and removes the other ops from them.
+func OpStage(mask Op) StageFunc {
+
+	return func(et Event, emit func(Event)) {
+		if op := et.Op() & mask; op != 0 {
+			emit(et.SetOp(op))
+		}
+	}
+}
+
+// RewriteStage replaces an event with the return of rewrite.
+func RewriteStage(rewrite func(et Event) Event) StageFunc {
+	return func(et Event, emit func(Event)) { emit(rewrite(et)) }
+}
+
+// AnnotateStage sets the value of key of an event to the return of value, see Event.Value.
+func AnnotateStage(key any, value func(et Event) any) StageFunc {
+	return func(et Event, emit func(Event)) { emit(et.WithValue(key, value(et))) }
+}
+
+// SplitOpsStage splits an event having several ops into one event per op, in the order of the op bits.
+func SplitOpsStage() StageFunc {
+
+	return func(et Event, emit func(Event)) {
+		var ops = et.Op()
+		for bit := Op(1); ops != 0 && bit != 0; bit <<= 1 {
+			if ops.Has(bit) {
+				ops &^= bit
+				emit(et.SetOp(bit))
+			}
+		}
+	}
+}
+
+// CountStage adds the number of events to counter, it can be read by a metrics exporter.
+func CountStage(counter *atomic.Uint64) StageFunc {
+
+	return func(et Event, emit func(Event)) {
+		counter.Add(1)
+		emit(et)
+	}
+}
@@ -0,0 +1,57 @@
+package watcher
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+type annotationKey struct{}
+
+func TestPipeline(t *testing.T) {
+
+	var counter atomic.Uint64
+	var p = Chain(func(etIn Event) (Event, bool) {
+		return etIn, etIn.Name() == "/skip"
+	}).
+		Use("ops", OpStage(Create|Write)).
+		Use("split", SplitOpsStage()).
+		Use("annotate", AnnotateStage(annotationKey{}, func(et Event) any { return et.Op().String() })).
+		Use("count", CountStage(&counter))
+
+	var ets = p.Process(newFsnotifyEventWrapper(fsnotify.Event{Name: "/a", Op: fsnotify.Create | fsnotify.Write | fsnotify.Chmod}))
+	if len(ets) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(ets))
+	}
+	for i, op := range []Op{Create, Write} {
+		if ets[i].Op() != op {
+			t.Errorf("expected op of event %d to be %s, got %s", i, op, ets[i].Op())
+		}
+		if ets[i].Value(annotationKey{}) != op.String() {
+			t.Errorf("expected annotation of event %d to be %s, got %v", i, op, ets[i].Value(annotationKey{}))
+		}
+	}
+	if ets = p.Process(newFsnotifyEventWrapper(fsnotify.Event{Name: "/skip", Op: fsnotify.Create})); len(ets) != 0 {
+		t.Fatalf("expected the event to be skipped, got %d events", len(ets))
+	}
+	if counter.Load() != 2 {
+		t.Errorf("expected counter to be 2, got %d", counter.Load())
+	}
+	var expected = []StageStats{{"hook-0", 2, 1}, {"ops", 1, 1}, {"split", 1, 2}, {"annotate", 2, 2}, {"count", 2, 2}}
+	var stats = p.Stages()
+	if len(stats) != len(expected) {
+		t.Fatalf("expected %d stages, got %d", len(expected), len(stats))
+	}
+	for i := range expected {
+		if stats[i] != expected[i] {
+			t.Errorf("expected stage %d to be %+v, got %+v", i, expected[i], stats[i])
+		}
+	}
+	if !p.Remove("split") || p.Remove("split") {
+		t.Error("expected split to be removed once")
+	}
+	if ets = p.Process(newFsnotifyEventWrapper(fsnotify.Event{Name: "/a", Op: fsnotify.Create | fsnotify.Write})); len(ets) != 1 {
+		t.Errorf("expected 1 event without split, got %d", len(ets))
+	}
+}
@@ -0,0 +1,81 @@
+package watcher
+
+import (
+	"path/filepath"
+)
+
+// PathKind is the kind of path a handler subscribes to, see HandlerKind.
+type PathKind int
+
+const (
+	// KindAny matches all paths, and it is the default.
+	KindAny PathKind = iota
+	// KindFile matches the paths those are not directories.
+	KindFile
+	// KindDir matches the directories.
+	KindDir
+)
+
+// HandlerPaths subscribes the handler to the events of the paths those are one of prefixes or below one of them, the
+// relative prefixes are made absolute by the working directory.
+func HandlerPaths(prefixes ...string) HandlerOption {
+
+	var abs = make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		if path, err := filepath.Abs(prefix); err == nil {
+			prefix = path
+		}
+		abs = append(abs, filepath.Clean(prefix))
+	}
+	return func(cfg *handlerConfig) { cfg.prefixes = append(cfg.prefixes, abs...) }
+}
+
+// HandlerGlob subscribes the handler to the events of the paths kept by f. The patterns are matched against the whole
+// '/' separated path, so start them with "**/" to match at any level, e.g. "**/*.yaml" and "!**/testdata/**".
+func HandlerGlob(f *GlobFilter) HandlerOption {
+	return func(cfg *handlerConfig) { cfg.globs = append(cfg.globs, f) }
+}
+
+// HandlerKind subscribes the handler to the events of the paths of kind. The kind is known by Event.FileInfo, so the
+// events of a path which does not exist anymore and has no FileInfo are matched by all kinds.
+func HandlerKind(kind PathKind) HandlerOption {
+	return func(cfg *handlerConfig) { cfg.kind = kind }
+}
+
+// HandlerFilter subscribes the handler to the events those filter returns true for, it is called by the goroutine
+// dispatching the events, so it should be fast.
+func HandlerFilter(filter func(et Event) bool) HandlerOption {
+	return func(cfg *handlerConfig) { cfg.filters = append(cfg.filters, filter) }
+}
+
+// isSubscribed reports whether et matches all subscriptions of cfg, the ops are matched by maskOp.
+func (cfg *handlerConfig) isSubscribed(et Event) bool {
+
+	if len(cfg.prefixes) > 0 {
+		var isBelow = false
+		for _, prefix := range cfg.prefixes {
+			if isBelow = isPathBelow(et.Name(), prefix); isBelow {
+				break
+			}
+		}
+		if !isBelow {
+			return false
+		}
+	}
+	for _, f := range cfg.globs {
+		if !f.Match(filepath.ToSlash(et.Name())) {
+			return false
+		}
+	}
+	if cfg.kind != KindAny {
+		if info := et.FileInfo(); info != nil && info.IsDir() != (cfg.kind == KindDir) {
+			return false
+		}
+	}
+	for _, filter := range cfg.filters {
+		if !filter(et) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xiaoyang-chen/file-watcher/logger"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestDispatcherSubscriptions(t *testing.T) {
+
+	var testDir = t.TempDir()
+	var config, assets = filepath.Join(testDir, "config"), filepath.Join(testDir, "assets")
+	for _, dir := range []string{config, assets} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var yaml, css = filepath.Join(config, "app.yaml"), filepath.Join(assets, "site.css")
+	for _, file := range []string{yaml, css} {
+		if err := os.WriteFile(file, []byte("a"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	yamlGlob, err := NewGlobFilter("**/*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reloader, rebuilder, dirs, audit = new(eventCollector), new(eventCollector), new(eventCollector), new(eventCollector)
+	var d = newDispatcher(logger.NewNoop(), newErrorReporter(logger.NewNoop()), handlerConfig{}, []FSEventHandler{
+		ConfigureHandler(reloader, HandlerPaths(config), HandlerGlob(yamlGlob), HandlerOps(Write)),
+		ConfigureHandler(rebuilder, HandlerPaths(assets), HandlerKind(KindFile)),
+		ConfigureHandler(dirs, HandlerKind(KindDir), HandlerFilter(func(et Event) bool { return et.Name() != testDir })),
+		audit,
+	})
+	defer d.close()
+	var ets = []fsnotify.Event{
+		{Name: testDir, Op: fsnotify.Write},
+		{Name: config, Op: fsnotify.Create},
+		{Name: yaml, Op: fsnotify.Create | fsnotify.Write},
+		{Name: assets, Op: fsnotify.Create},
+		{Name: css, Op: fsnotify.Write},
+	}
+	for _, et := range ets {
+		d.dispatch(newFsnotifyEventWrapper(et))
+	}
+	if !audit.waitFor(css, Write, time.Second) {
+		t.Fatal("expected all events to be handled")
+	}
+	time.Sleep(20 * time.Millisecond)
+	for name, tc := range map[string]struct {
+		collector *eventCollector
+		expected  []string
+	}{
+		"reloader":  {reloader, []string{yaml}},
+		"rebuilder": {rebuilder, []string{css}},
+		"dirs":      {dirs, []string{config, assets}},
+		"audit":     {audit, []string{testDir, config, yaml, assets, css}},
+	} {
+		tc.collector.mu.Lock()
+		if len(tc.collector.events) != len(tc.expected) {
+			t.Errorf("expected %s to receive %d events, got %d", name, len(tc.expected), len(tc.collector.events))
+		} else {
+			for i, et := range tc.collector.events {
+				if et.Name() != tc.expected[i] {
+					t.Errorf("expected event %d of %s to be %s, got %s", i, name, tc.expected[i], et.Name())
+				}
+			}
+		}
+		tc.collector.mu.Unlock()
+	}
+	reloader.mu.Lock()
+	defer reloader.mu.Unlock()
+	if len(reloader.events) == 1 && reloader.events[0].Op() != Write {
+		t.Errorf("expected the ops of reloader to be masked, got %s", reloader.events[0].Op())
+	}
+}
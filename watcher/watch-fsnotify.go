@@ -0,0 +1,211 @@
+package watcher
+
+import (
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+type fsnotifyWatcherWrapper struct {
+	*watcherCore
+	watcher      *fsnotify.Watcher
+	ignoreHidden bool
+	globFilter   *GlobFilter
+	gitIgnore    *gitIgnore  // nil if WithGitIgnore is not used.
+	reconciler   *reconciler // nil if WithReconcile is not used.
+	ids          *fileIDs    // ids of the known paths, see renamePairer.
+	// mu protects the following.
+	mu    *sync.Mutex
+	names map[string]bool     // paths added by AddPaths and AddRecursive, bool for recursive or not.
+	dirs  map[string]struct{} // directories watched because they are below a recursive root, and the file roots.
+}
+
+func newFsnotifyWatcher(o *options) (watcher Watcher, err error) {
+
+	var core = newWatcherCore(o)
+	var wrapper fsnotifyWatcherWrapper
+	if wrapper, err = newFsnotifyBackend(o, core); err != nil {
+		core.Close() // stop the dispatcher
+		return
+	}
+	core.stopBackend = wrapper.closeBackend
+	core.waitLoops()
+	watcher = wrapper
+	return
+}
+
+// newFsnotifyBackend starts the fsnotify backend passing its events to core, the caller sets core.stopBackend and
+// calls core.waitLoops.
+func newFsnotifyBackend(o *options, core *watcherCore) (wrapper fsnotifyWatcherWrapper, err error) {
+
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	wrapper = fsnotifyWatcherWrapper{
+		watcherCore:  core,
+		watcher:      fw,
+		ignoreHidden: o.ignoreHidden,
+		globFilter:   o.globFilter,
+		ids:          newFileIDs(),
+		mu:           new(sync.Mutex),
+		names:        make(map[string]bool, 4),
+		dirs:         make(map[string]struct{}, 8),
+	}
+	if o.gitIgnore {
+		wrapper.gitIgnore = newGitIgnore()
+	}
+	if o.reconcile {
+		wrapper.reconciler = newReconciler(o.reconcileInterval)
+	}
+	wrapper.loops.Add(1)
+	go func(wrapper fsnotifyWatcherWrapper) {
+		defer wrapper.loopExit()
+		var pairer = newRenamePairer(wrapper.ids)
+		var reconcileTick <-chan time.Time
+		if wrapper.reconciler != nil {
+			var stopTick func()
+			reconcileTick, stopTick = wrapper.reconciler.ticker()
+			defer stopTick()
+		}
+		for {
+			select {
+			case et, ok := <-wrapper.watcher.Events:
+				if !ok {
+					wrapper.handleEvents(BackendFsnotify, pairer.flush()...)
+					wrapper.logHandler.Warn("watcher event chan was closed")
+					return
+				}
+				wrapper.followIgnoreFile(et.Name)
+				if (wrapper.ignoreHidden && isHiddenPath(et.Name)) || wrapper.isEventExcluded(et.Name) {
+					continue
+				}
+				for _, et = range wrapper.followRecursive(et) {
+					if wrapper.reconciler != nil {
+						wrapper.reconciler.observe(et)
+					}
+					// a new directory not included by the glob filter is still followed for the files below it.
+					if wrapper.isGlobKept(et.Name) {
+						wrapper.handleEvents(BackendFsnotify, pairer.pair(et)...)
+					}
+				}
+			case <-pairer.timeout():
+				wrapper.handleEvents(BackendFsnotify, pairer.flush()...)
+			case <-reconcileTick:
+				wrapper.handleReconciled(pairer)
+			case err, ok := <-wrapper.watcher.Errors:
+				if !ok {
+					wrapper.logHandler.Warn("watcher error chan was closed")
+					return
+				}
+				wrapper.reporter.report(errors.WithStack(err))
+				// the events dropped by the kernel are found by scanning.
+				if wrapper.reconciler != nil && errors.Is(err, fsnotify.ErrEventOverflow) {
+					wrapper.handleReconciled(pairer)
+				}
+			}
+		}
+	}(wrapper)
+	return
+}
+
+func (w fsnotifyWatcherWrapper) closeBackend() (err error) {
+	return errors.WithStack(w.watcher.Close())
+}
+
+func (w fsnotifyWatcherWrapper) AddPaths(paths ...string) (err error) {
+
+	for _, path := range paths {
+		if path, err = filepath.Abs(path); err != nil {
+			err = errors.WithStack(err)
+			break
+		}
+		if err = w.watcher.Add(path); err != nil {
+			err = errors.WithStack(err)
+			break
+		}
+		w.ids.rememberName(path)
+		w.mu.Lock()
+		if !w.names[path] {
+			w.names[path] = false
+		}
+		w.mu.Unlock()
+		w.seedName(path, false)
+	}
+	return
+}
+func (w fsnotifyWatcherWrapper) AddRecursive(paths ...string) (err error) {
+
+	for _, path := range paths {
+		if path, err = filepath.Abs(path); err != nil {
+			err = errors.WithStack(err)
+			break
+		}
+		// the root is set before walking, because the glob filter matches the paths relative to it.
+		w.mu.Lock()
+		var recursive, found = w.names[path]
+		w.names[path] = true
+		w.mu.Unlock()
+		if _, err = w.addDirsRecursive(path); err != nil {
+			w.mu.Lock()
+			if found {
+				w.names[path] = recursive
+			} else {
+				delete(w.names, path)
+			}
+			w.mu.Unlock()
+			// the directories watched before the failure are dropped unless another name needs them.
+			w.removeDirs(path)
+			break
+		}
+		w.seedName(path, true)
+	}
+	return
+}
+func (w fsnotifyWatcherWrapper) RemovePaths(paths ...string) (err error) {
+
+	for _, path := range paths {
+		if path, err = filepath.Abs(path); err != nil {
+			err = errors.WithStack(err)
+			break
+		}
+		w.mu.Lock()
+		var recursive, found = w.names[path]
+		delete(w.names, path)
+		var _, isDir = w.dirs[path]
+		w.mu.Unlock()
+		if !found {
+			continue
+		}
+		// the directories still needed by the other names are kept.
+		if recursive || isDir {
+			w.removeDirs(path)
+			continue
+		}
+		if w.isBelowRecursive(path) {
+			continue
+		}
+		if err = w.watcher.Remove(path); err != nil && !errors.Is(err, fsnotify.ErrNonExistentWatch) {
+			err = errors.WithStack(err)
+			break
+		}
+		err = nil
+	}
+	return
+}
+func (w fsnotifyWatcherWrapper) WatchList() (list []string) {
+
+	w.mu.Lock()
+	list = make([]string, 0, len(w.names))
+	for name := range w.names {
+		list = append(list, name)
+	}
+	w.mu.Unlock()
+	sort.Strings(list)
+	return
+}
@@ -0,0 +1,163 @@
+package watcher
+
+import (
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// detectUnreliableFS is unreliableFSType, it is replaced by tests.
+var detectUnreliableFS = unreliableFSType
+
+// hybridWatcherWrapper watches a path by fsnotify, and falls back to polling for the paths on a filesystem which
+// fsnotify is known to be unreliable on, or if fsnotify fails to add the path, e.g. the limit of inotify watches is hit.
+// Both backends pass their events to one core, so the handlers see a single stream, see Event.Source for the backend
+// of an event.
+type hybridWatcherWrapper struct {
+	*watcherCore
+	fsnotify fsnotifyWatcherWrapper
+	polling  radovskybwatcherWatcherWrapper
+	// mu protects names.
+	mu    *sync.Mutex
+	names map[string]Backend // paths added by AddPaths and AddRecursive, and the backend watching them.
+}
+
+func newHybridWatcher(o *options) (watcher Watcher, err error) {
+
+	var wrapper = hybridWatcherWrapper{watcherCore: newWatcherCore(o), mu: new(sync.Mutex), names: make(map[string]Backend, 4)}
+	if wrapper.fsnotify, err = newFsnotifyBackend(o, wrapper.watcherCore); err != nil {
+		wrapper.watcherCore.Close() // stop the dispatcher
+		return
+	}
+	if wrapper.polling, err = newRadovskybwatcherBackend(o, wrapper.watcherCore); err != nil {
+		wrapper.watcherCore.Close()
+		_ = wrapper.fsnotify.closeBackend()
+		return
+	}
+	wrapper.stopBackend = func() (err error) {
+		err = wrapper.fsnotify.closeBackend()
+		if pollingErr := wrapper.polling.closeBackend(); err == nil {
+			err = pollingErr
+		}
+		return
+	}
+	wrapper.waitLoops()
+	watcher = wrapper
+	return
+}
+
+// add watches path by the backend already watching it, or by fsnotify and falls back to polling.
+func (w hybridWatcherWrapper) add(path string, recursive bool, interval time.Duration) (err error) {
+
+	if path, err = filepath.Abs(path); err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	w.mu.Lock()
+	var backend, found = w.names[path]
+	w.mu.Unlock()
+	switch {
+	case found:
+	case interval > 0:
+		backend = BackendRadovskybwatcher
+	default:
+		backend = BackendFsnotify
+		if fsType, isUnreliable := detectUnreliableFS(path); isUnreliable {
+			w.logHandler.Info("watch by polling on filesystem ", fsType, ": ", path)
+			backend = BackendRadovskybwatcher
+		}
+	}
+	if backend == BackendFsnotify {
+		if recursive {
+			err = w.fsnotify.AddRecursive(path)
+		} else {
+			err = w.fsnotify.AddPaths(path)
+		}
+		if err != nil && !found {
+			// the directories watched before the failure are dropped by AddRecursive of fsnotify.
+			w.logHandler.Warn("watch by fsnotify fail, fall back to polling: ", path, ", err: ", err)
+			backend = BackendRadovskybwatcher
+		}
+	}
+	if backend == BackendRadovskybwatcher {
+		if recursive {
+			err = w.polling.AddRecursiveWithInterval(interval, path)
+		} else {
+			err = w.polling.AddWithInterval(interval, path)
+		}
+	}
+	if err != nil {
+		return
+	}
+	w.mu.Lock()
+	w.names[path] = backend
+	w.mu.Unlock()
+	return
+}
+
+func (w hybridWatcherWrapper) AddPaths(paths ...string) (err error) {
+	return w.AddWithInterval(0, paths...)
+}
+func (w hybridWatcherWrapper) AddRecursive(paths ...string) (err error) {
+	return w.AddRecursiveWithInterval(0, paths...)
+}
+func (w hybridWatcherWrapper) AddWithInterval(interval time.Duration, paths ...string) (err error) {
+
+	for _, path := range paths {
+		if err = w.add(path, false, interval); err != nil {
+			break
+		}
+	}
+	return
+}
+func (w hybridWatcherWrapper) AddRecursiveWithInterval(interval time.Duration, paths ...string) (err error) {
+
+	for _, path := range paths {
+		if err = w.add(path, true, interval); err != nil {
+			break
+		}
+	}
+	return
+}
+func (w hybridWatcherWrapper) RemovePaths(paths ...string) (err error) {
+
+	for _, path := range paths {
+		if path, err = filepath.Abs(path); err != nil {
+			err = errors.WithStack(err)
+			break
+		}
+		w.mu.Lock()
+		var backend, found = w.names[path]
+		w.mu.Unlock()
+		if !found {
+			continue
+		}
+		if backend == BackendFsnotify {
+			err = w.fsnotify.RemovePaths(path)
+		} else {
+			err = w.polling.RemovePaths(path)
+		}
+		if err != nil {
+			break
+		}
+		w.mu.Lock()
+		delete(w.names, path)
+		w.mu.Unlock()
+	}
+	return
+}
+func (w hybridWatcherWrapper) ScanStats() ScanStats { return w.polling.ScanStats() }
+func (w hybridWatcherWrapper) WatchList() (list []string) {
+
+	w.mu.Lock()
+	list = make([]string, 0, len(w.names))
+	for name := range w.names {
+		list = append(list, name)
+	}
+	w.mu.Unlock()
+	sort.Strings(list)
+	return
+}
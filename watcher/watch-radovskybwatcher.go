@@ -0,0 +1,357 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	radovskybwatcher "github.com/xiaoyang-chen/file-watcher/radovskyb-watcher"
+
+	"github.com/pkg/errors"
+)
+
+// contentHashKey is the key of Event.Value set on the events of the files hashed by the polling backend.
+type contentHashKey struct{}
+
+// ContentHash returns the sum of the content of the file of et, see WithContentHash. It is nil if the file is not
+// hashed, e.g. et is not produced by polling, or the file is too large or can not be read. A handler can compare it with
+// the sum it handled last time to skip a write which does not change the content.
+func ContentHash(et Event) []byte {
+
+	var sum, _ = et.Value(contentHashKey{}).([]byte)
+	return sum
+}
+
+// ScanStats counts the work of the incremental scans of the polling backend, see WithIncrementalScan.
+type ScanStats = radovskybwatcher.ScanStats
+
+// IntervalWatcher is implemented by the watchers of BackendRadovskybwatcher and BackendHybrid, assert a Watcher to it to
+// poll paths by their own intervals instead of the interval of WithPollInterval, e.g. hot config files every 200ms and an
+// archive every 5 minutes. The paths are scanned every interval if it is greater than 0, else by every polling cycle.
+// BackendHybrid polls a path added with an interval greater than 0 unless it is watched by fsnotify already.
+type IntervalWatcher interface {
+	AddWithInterval(interval time.Duration, paths ...string) error
+	AddRecursiveWithInterval(interval time.Duration, paths ...string) error
+}
+
+// ScanStatsReporter is implemented by the watchers of BackendRadovskybwatcher and BackendHybrid, assert a Watcher to it
+// to read the counters of the polling backend, e.g. StatsSaved for the stats saved by WithIncrementalScan.
+type ScanStatsReporter interface {
+	ScanStats() ScanStats
+}
+
+type radovskybwatcherWatcherWrapper struct {
+	*watcherCore
+	watcher      *radovskybwatcher.Watcher
+	watchGap     time.Duration
+	errChanStart chan error
+	pathFilter   *pathFilter     // nil if there is no glob filter and WithGitIgnore is not used.
+	snapshotPath string          // empty if WithSnapshot is not used.
+	savers       *sync.WaitGroup // counts saveSnapshots, closeBackend waits for it before the last save.
+}
+
+// pathFilter filters the paths of the polling backend by the glob filter and the ignore files, it keeps the watched
+// names by its own lock because the filter hook is called by the walkers of radovskybwatcher.Watcher concurrently.
+type pathFilter struct {
+	globFilter *GlobFilter
+	gitIgnore  *gitIgnore
+	// mu protects names.
+	mu    *sync.RWMutex
+	names map[string]struct{}
+}
+
+// add adds name, isAdded is false if name is already added.
+func (f *pathFilter) add(name string) (isAdded bool) {
+
+	f.mu.Lock()
+	if _, found := f.names[name]; !found {
+		f.names[name], isAdded = struct{}{}, true
+	}
+	f.mu.Unlock()
+	return
+}
+
+func (f *pathFilter) remove(name string) {
+
+	f.mu.Lock()
+	delete(f.names, name)
+	f.mu.Unlock()
+}
+
+// hook skips the paths those are not kept by the filters, and the excluded directories are not walked.
+func (f *pathFilter) hook(info os.FileInfo, fullPath string) (err error) {
+
+	f.mu.RLock()
+	var roots = make([]string, 0, len(f.names))
+	for name := range f.names {
+		roots = append(roots, name)
+	}
+	f.mu.RUnlock()
+	var root, isFound = rootOf(fullPath, roots)
+	if !isFound {
+		return
+	}
+	var rel string
+	if rel, err = filepath.Rel(root, fullPath); err != nil {
+		return nil
+	}
+	var isExcluded = f.gitIgnore != nil && f.gitIgnore.isIgnored(root, fullPath, info.IsDir())
+	if f.globFilter != nil {
+		isExcluded = isExcluded || f.globFilter.IsExcluded(rel)
+	}
+	switch {
+	case isExcluded && info.IsDir():
+		err = filepath.SkipDir
+	case isExcluded, f.globFilter != nil && !f.globFilter.Match(rel):
+		err = radovskybwatcher.ErrSkip
+	}
+	return
+}
+
+func newRadovskybwatcherWatcher(o *options) (watcher Watcher, err error) {
+
+	var core = newWatcherCore(o)
+	var wrapper radovskybwatcherWatcherWrapper
+	if wrapper, err = newRadovskybwatcherBackend(o, core); err != nil {
+		core.Close() // stop the dispatcher
+		return
+	}
+	core.stopBackend = wrapper.closeBackend
+	core.waitLoops()
+	watcher = wrapper
+	return
+}
+
+// newRadovskybwatcherBackend starts the polling backend passing its events to core, the caller sets core.stopBackend
+// and calls core.waitLoops.
+func newRadovskybwatcherBackend(o *options, core *watcherCore) (wrapper radovskybwatcherWatcherWrapper, err error) {
+
+	wrapper = radovskybwatcherWatcherWrapper{
+		watcherCore:  core,
+		watcher:      radovskybwatcher.New(),
+		watchGap:     o.pollInterval,
+		errChanStart: make(chan error, 1),
+		snapshotPath: o.snapshotPath,
+		savers:       new(sync.WaitGroup),
+	}
+	if wrapper.snapshotPath != "" {
+		if err = wrapper.watcher.LoadSnapshot(wrapper.snapshotPath); err != nil {
+			err = errors.WithStack(err)
+			return
+		}
+	}
+	wrapper.watcher.IgnoreHiddenFiles(o.ignoreHidden)
+	wrapper.watcher.SetMaxEvents(o.maxEvents)
+	wrapper.watcher.SetHash(o.contentHash)
+	wrapper.watcher.ReportChildMoves(o.childMoves)
+	wrapper.watcher.SetIncrementalScan(o.fullScanInterval)
+	wrapper.watcher.SetWalkers(o.walkers)
+	wrapper.watcher.SetAdaptiveInterval(o.adaptiveInterval)
+	if len(o.ops) > 0 {
+		wrapper.watcher.FilterOps(toRadovskybwatcherOps(o.ops)...)
+	}
+	// the events are filtered by the listing, because the paths skipped by the filter hook are never scanned.
+	if o.globFilter != nil || o.gitIgnore {
+		wrapper.pathFilter = &pathFilter{globFilter: o.globFilter, mu: new(sync.RWMutex), names: make(map[string]struct{}, 4)}
+		if o.gitIgnore {
+			wrapper.pathFilter.gitIgnore = newGitIgnore()
+		}
+		wrapper.watcher.AddFilterHook(wrapper.pathFilter.hook)
+	}
+	wrapper.loops.Add(1)
+	go func(wrapper radovskybwatcherWatcherWrapper) {
+		defer wrapper.loopExit()
+		for {
+			select {
+			case et, ok := <-wrapper.watcher.Event:
+				if !ok {
+					wrapper.logHandler.Warn("watcher event chan was closed")
+					return
+				}
+				// the changed rules are used by the next scan.
+				if wrapper.pathFilter != nil && wrapper.pathFilter.gitIgnore != nil {
+					wrapper.pathFilter.gitIgnore.invalidate(et.Path)
+				}
+				var wrapped = newRadovskybwatcherEventWrapper(et)
+				if sum := et.Hash(); sum != nil {
+					wrapped = wrapped.WithValue(contentHashKey{}, sum)
+				}
+				wrapper.handleEvents(BackendRadovskybwatcher, wrapped)
+			case err, ok := <-wrapper.watcher.Error:
+				if !ok {
+					wrapper.logHandler.Warn("watcher error chan was closed")
+					return
+				}
+				wrapper.reporter.report(errors.WithStack(err))
+			case <-wrapper.watcher.Closed:
+				wrapper.logHandler.Warn("watcher was closed")
+				return
+			}
+		}
+	}(wrapper)
+	var funcStart = func(wrapper radovskybwatcherWatcherWrapper) {
+		// we should not use wrapper.watcher.Wait(), because it will cause this go routine leaks if wrapper.watcher.Start returns first before wrapper.watcher.Wait()
+		// wrapper.watcher.Wait(); wrapper.errChanStart <- nil
+		wrapper.errChanStart <- wrapper.watcher.Start(wrapper.watchGap)
+	}
+	// we run twice for checking whether watcher starts success
+	go funcStart(wrapper)
+	go funcStart(wrapper)
+	if err = <-wrapper.errChanStart; err != radovskybwatcher.ErrWatcherRunning {
+		// clear resource and started golang routine, the watcher is stopping so the event loop exits without error. the
+		// snapshot is not saved, the watcher has not scanned anything.
+		wrapper.stop()
+		wrapper.watcher.Close()
+		err = errors.WithStack(err)
+		return
+	}
+	err = nil
+	if wrapper.snapshotPath != "" && o.snapshotInterval > 0 {
+		wrapper.savers.Add(1)
+		go wrapper.saveSnapshots(o.snapshotInterval)
+	}
+	return
+}
+
+func (w radovskybwatcherWatcherWrapper) closeBackend() (err error) {
+
+	// stopping is closed already, a periodic save must not overwrite the snapshot after Close clears the files.
+	w.savers.Wait()
+	if w.snapshotPath != "" {
+		if err = w.watcher.SaveSnapshot(w.snapshotPath); err != nil {
+			err = errors.WithStack(err)
+		}
+	}
+	w.watcher.Close()
+	return
+}
+
+// saveSnapshots saves the snapshot every interval until the watcher is stopping.
+func (w radovskybwatcherWatcherWrapper) saveSnapshots(interval time.Duration) {
+
+	defer w.savers.Done()
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stopping:
+			return
+		case <-ticker.C:
+			if err := w.watcher.SaveSnapshot(w.snapshotPath); err != nil {
+				w.reporter.report(errors.WithStack(err))
+			}
+		}
+	}
+}
+
+// toRadovskybwatcherOps returns the radovskybwatcher ops of ops, see _mapRadovskybwatcherOp.
+func toRadovskybwatcherOps(ops []Op) (rOps []radovskybwatcher.Op) {
+
+	var mask = opMask(ops)
+	for rOp, op := range _mapRadovskybwatcherOp {
+		if mask.Has(op) {
+			rOps = append(rOps, rOp)
+		}
+	}
+	return
+}
+
+// addFilterRoot adds path to the names of the path filter before it is listed, undo removes it again if listing fails.
+func (w radovskybwatcherWatcherWrapper) addFilterRoot(path string) (undo func(), err error) {
+
+	undo = func() {}
+	if w.pathFilter == nil {
+		return
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	if w.pathFilter.add(path) {
+		undo = func() { w.pathFilter.remove(path) }
+	}
+	return
+}
+
+func (w radovskybwatcherWatcherWrapper) add(path string, recursive bool, interval time.Duration) (err error) {
+
+	var undo func()
+	if undo, err = w.addFilterRoot(path); err != nil {
+		return
+	}
+	if recursive {
+		err = w.watcher.AddRecursiveWithInterval(path, interval)
+	} else {
+		err = w.watcher.AddWithInterval(path, interval)
+	}
+	if err != nil {
+		undo()
+		err = errors.WithStack(err)
+	}
+	return
+}
+
+func (w radovskybwatcherWatcherWrapper) AddPaths(paths ...string) (err error) {
+	return w.AddWithInterval(0, paths...)
+}
+func (w radovskybwatcherWatcherWrapper) AddRecursive(paths ...string) (err error) {
+	return w.AddRecursiveWithInterval(0, paths...)
+}
+func (w radovskybwatcherWatcherWrapper) AddWithInterval(interval time.Duration, paths ...string) (err error) {
+
+	for _, path := range paths {
+		if err = w.add(path, false, interval); err != nil {
+			break
+		}
+	}
+	return
+}
+func (w radovskybwatcherWatcherWrapper) AddRecursiveWithInterval(interval time.Duration, paths ...string) (err error) {
+
+	for _, path := range paths {
+		if err = w.add(path, true, interval); err != nil {
+			break
+		}
+	}
+	return
+}
+func (w radovskybwatcherWatcherWrapper) RemovePaths(paths ...string) (err error) {
+
+	var names = w.watcher.WatchedNames()
+	for _, path := range paths {
+		if path, err = filepath.Abs(path); err != nil {
+			err = errors.WithStack(err)
+			break
+		}
+		var recursive, found = names[path]
+		if !found {
+			continue
+		}
+		if recursive {
+			err = w.watcher.RemoveRecursive(path)
+		} else {
+			err = w.watcher.Remove(path)
+		}
+		if err != nil {
+			err = errors.WithStack(err)
+			break
+		}
+		if w.pathFilter != nil {
+			w.pathFilter.remove(path)
+		}
+	}
+	return
+}
+func (w radovskybwatcherWatcherWrapper) ScanStats() ScanStats { return w.watcher.Stats() }
+func (w radovskybwatcherWatcherWrapper) WatchList() (list []string) {
+
+	var names = w.watcher.WatchedNames()
+	list = make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return
+}
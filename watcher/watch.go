@@ -1,197 +1,202 @@
 package watcher
 
 import (
+	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	logger "github.com/xiaoyang-chen/file-watcher/logger"
-	radovskybwatcher "github.com/xiaoyang-chen/file-watcher/radovskyb-watcher"
 
-	"github.com/fsnotify/fsnotify"
 	"github.com/pkg/errors"
 )
 
+// ErrUnknownBackend is returned by New when the backend is not supported.
+var ErrUnknownBackend = errors.New("error: unknown backend")
+
 type FSEventHandler interface {
 	FSHandle(event Event)
 }
 
+// FSEventHandlerWithError is an optional interface of FSEventHandler, if a handler implements it, FSHandleWithError is
+// called instead of FSHandle and the returned error is reported as a *HandlerError to the error handler of the watcher.
+type FSEventHandlerWithError interface {
+	FSEventHandler
+	FSHandleWithError(event Event) (err error)
+}
+
+// ErrorHandlerFunc receives the errors of a watcher, those are the errors of the backend, *HandlerError of the handlers
+// and ErrQueueFull of OverflowReport, it is called by the goroutines of the watcher so it should not block.
+type ErrorHandlerFunc func(err error)
+
 type EventHookFunc func(etIn Event) (etOut Event, isSkip bool)
 
+// Backend identifies the implementation of a watcher, see Event.Source.
+type Backend string
+
+const (
+	BackendFsnotify         Backend = "fsnotify"         // github.com/fsnotify/fsnotify
+	BackendRadovskybwatcher Backend = "radovskybwatcher" // https://github.com/radovskyb/watcher
+	// BackendHybrid watches a path by BackendFsnotify, and by BackendRadovskybwatcher if the path is on a filesystem
+	// fsnotify is known to be unreliable on, like NFS, SMB and FUSE, or if fsnotify fails to watch it. It is not an
+	// Event.Source, the events have the backend watching their path.
+	BackendHybrid Backend = "hybrid"
+)
+
 type Watcher interface {
 	AddPaths(paths ...string) (err error)
+	// AddRecursive adds paths and all directories below them, directories created below them after adding are watched too.
+	AddRecursive(paths ...string) (err error)
+	// RemovePaths stops watching paths, a path added by AddRecursive is removed with all directories below it, removing a path that is not watched is a no-op.
+	RemovePaths(paths ...string) (err error)
+	// WatchList returns the sorted absolute paths added by AddPaths and AddRecursive.
+	WatchList() []string
+	// SetErrorHandler sets the receiver of the errors of the watcher, the errors are always logged by the logger.
+	SetErrorHandler(errorHandler ErrorHandlerFunc)
+	// Subscribe adds handler with its options at runtime, see ConfigureHandler. The handler receives the events dispatched
+	// after Subscribe returns, in order, and none of the events dispatched before Subscribe is called. After unsubscribe
+	// returns, no more events are queued for the handler, the events already in its queue are still handled but the event
+	// being queued for it may be dropped. unsubscribe does not wait for the handler, it can be called more than once and
+	// by the handler itself. Subscribe does nothing after the watcher stops, and both may wait for an event being
+	// dispatched to a handler with a full queue and OverflowBlock.
+	Subscribe(handler FSEventHandler, opts ...HandlerOption) (unsubscribe func())
+	// Pipeline returns the pipeline run after the event hook, its stages can be changed at runtime, see WithPipeline.
+	Pipeline() *Pipeline
+	// Events returns the channel receiving the events alongside the handlers, it is closed after the watcher stops.
+	Events() <-chan Event
+	// Errors returns the channel receiving the errors of the watcher alongside the error handler, it is closed after
+	// the watcher stops.
+	Errors() <-chan error
+	// Run blocks until ctx is done or the watcher stops, then it shuts the watcher down gracefully, see Shutdown.
+	Run(ctx context.Context) (err error)
+	// Shutdown stops watching, waits until the queued events are handled by the handlers up to the deadline of ctx,
+	// and returns the terminal error of the watcher.
+	Shutdown(ctx context.Context) (err error)
+	// Close stops watching at once and drops the queued events.
 	Close() (err error)
 }
 
 var _ Watcher = fsnotifyWatcherWrapper{}         // github.com/fsnotify/fsnotify
 var _ Watcher = radovskybwatcherWatcherWrapper{} // https://github.com/radovskyb/watcher
-
-type fsnotifyWatcherWrapper struct {
-	logHandler logger.Logger
-	eventHook  EventHookFunc
-	handlers   []FSEventHandler
-	watcher    *fsnotify.Watcher
-}
-
-func (w fsnotifyWatcherWrapper) AddPaths(paths ...string) (err error) {
-
-	for _, path := range paths {
-		if err = w.watcher.Add(path); err != nil {
-			err = errors.WithStack(err)
-			break
-		}
+var _ Watcher = hybridWatcherWrapper{}
+
+var _ ScanStatsReporter = radovskybwatcherWatcherWrapper{}
+var _ ScanStatsReporter = hybridWatcherWrapper{}
+
+var _ IntervalWatcher = radovskybwatcherWatcherWrapper{}
+var _ IntervalWatcher = hybridWatcherWrapper{}
+
+// New creates a watcher of backend configured by opts, it starts watching after it is created.
+func New(backend Backend, opts ...Option) (watcher Watcher, err error) {
+
+	var o = newOptions(opts)
+	switch backend {
+	case BackendFsnotify:
+		watcher, err = newFsnotifyWatcher(o)
+	case BackendRadovskybwatcher:
+		watcher, err = newRadovskybwatcherWatcher(o)
+	case BackendHybrid:
+		watcher, err = newHybridWatcher(o)
+	default:
+		err = errors.WithMessage(ErrUnknownBackend, string(backend))
 	}
 	return
 }
-func (w fsnotifyWatcherWrapper) Close() (err error) {
 
-	if w.watcher != nil {
-		err = errors.WithStack(w.watcher.Close())
-	}
-	return
+// NewFsnotifyWatcher is the same as New(BackendFsnotify, WithLogger(logHandler), WithEventHook(eventHook), WithHandlers(fsEventHandlers...)).
+func NewFsnotifyWatcher(logHandler logger.Logger, eventHook EventHookFunc, fsEventHandlers ...FSEventHandler) (watcher Watcher, err error) {
+	return New(BackendFsnotify, WithLogger(logHandler), WithEventHook(eventHook), WithHandlers(fsEventHandlers...))
 }
 
-type radovskybwatcherWatcherWrapper struct {
-	logHandler   logger.Logger
-	eventHook    EventHookFunc
-	handlers     []FSEventHandler
-	watcher      *radovskybwatcher.Watcher
-	watchGap     time.Duration
-	errChanStart chan error
+// NewRadovskybwatcherWatcher watchGap is the sleep time in two loop scan, it will run cyclically as "scan -> sleep(watchGap) -> scan -> ...",
+// it is the same as New(BackendRadovskybwatcher, WithLogger(logHandler), WithEventHook(eventHook), WithPollInterval(watchGap), WithHandlers(fsEventHandlers...)).
+func NewRadovskybwatcherWatcher(logHandler logger.Logger, eventHook EventHookFunc, watchGap time.Duration, fsEventHandlers ...FSEventHandler) (watcher Watcher, err error) {
+	return New(BackendRadovskybwatcher, WithLogger(logHandler), WithEventHook(eventHook), WithPollInterval(watchGap), WithHandlers(fsEventHandlers...))
 }
 
-func (w radovskybwatcherWatcherWrapper) AddPaths(paths ...string) (err error) {
-
-	for _, path := range paths {
-		if err = w.watcher.Add(path); err != nil {
-			err = errors.WithStack(err)
-			break
-		}
-	}
-	return
+// watcherCore is shared by the wrappers of all backends, it passes the events of a backend through the event hook and
+// dispatches them to the handlers.
+type watcherCore struct {
+	lifecycle
+	logHandler logger.Logger
+	eventHook  EventHookFunc
+	pipeline   *Pipeline
+	dispatcher *dispatcher
+	reporter   *errorReporter
+	seq        *atomic.Uint64
+	handleMu   *sync.Mutex // serializes handleEvents, the hybrid watcher has an event loop per backend.
+	ops        Op          // see WithOps, 0 means all ops.
+	// eventsHandler and errorsChan are used by Events and Errors.
+	eventsHandler *chanHandler
+	errorsChan    *errorsChan
 }
-func (w radovskybwatcherWatcherWrapper) Close() (err error) {
 
-	if w.watcher != nil {
-		w.watcher.Close()
-	}
-	return
-}
+func newWatcherCore(o *options) (core *watcherCore) {
 
-func NewFsnotifyWatcher(logHandler logger.Logger, eventHook EventHookFunc, fsEventHandlers ...FSEventHandler) (watcher Watcher, err error) {
+	core = &watcherCore{
+		lifecycle:  newLifecycle(o.shutdownTimeout),
+		logHandler: o.logHandler,
+		eventHook:  o.eventHook,
+		pipeline:   o.pipeline,
+		reporter:   newErrorReporter(o.logHandler),
+		seq:        new(atomic.Uint64),
+		handleMu:   new(sync.Mutex),
+		ops:        opMask(o.ops),
 
-	if logHandler == nil {
-		logHandler = logger.NewNoop()
+		eventsHandler: newChanHandler(o.eventsBuffer),
+		errorsChan:    newErrorsChan(o.errorsBuffer),
 	}
-	fw, err := fsnotify.NewWatcher()
-	if err != nil {
-		err = errors.WithStack(err)
-		return
-	}
-	var wrapper = fsnotifyWatcherWrapper{
-		logHandler: logHandler,
-		eventHook:  eventHook,
-		handlers:   fsEventHandlers,
-		watcher:    fw,
-	}
-	go func(wrapper fsnotifyWatcherWrapper) {
-		for {
-			select {
-			case et, ok := <-wrapper.watcher.Events:
-				if !ok {
-					wrapper.logHandler.Warn("watcher event chan was closed")
-					return
-				}
-				var etWarpper = newFsnotifyEventWrapper(et)
-				wrapper.logHandler.Info("event happen ", etWarpper.String())
-				if wrapper.eventHook != nil {
-					var isSkip = false
-					if etWarpper, isSkip = wrapper.eventHook(etWarpper); isSkip {
-						continue
-					}
-				}
-				eventTwoPartHandles(etWarpper, wrapper.handlers)
-			case err, ok := <-wrapper.watcher.Errors:
-				if !ok {
-					wrapper.logHandler.Warn("watcher error chan was closed")
-					return
-				}
-				wrapper.logHandler.Error(err)
-			}
-		}
-	}(wrapper)
-	watcher = wrapper
+	core.reporter.set(o.errorHandler)
+	core.reporter.errs = core.errorsChan
+	var handlers = append(append(make([]FSEventHandler, 0, len(o.handlers)+1), o.handlers...), core.eventsHandler)
+	core.dispatcher = newDispatcher(o.logHandler, core.reporter, o.handlerDefaults, handlers)
+	core.eventsHandler.closing = core.dispatcher.closing
+	go func() {
+		// only the worker of eventsHandler sends on events.
+		<-core.dispatcher.done
+		close(core.eventsHandler.events)
+		core.errorsChan.close()
+	}()
 	return
 }
 
-// NewRadovskybwatcherWatcher watchGap is the sleep time in two loop scan, it will run cyclically as "scan -> sleep(watchGap) -> scan -> ..."
-func NewRadovskybwatcherWatcher(logHandler logger.Logger, eventHook EventHookFunc, watchGap time.Duration, fsEventHandlers ...FSEventHandler) (watcher Watcher, err error) {
+// handleEvents masks the ops of ets from source by WithOps, passes them through the event hook and the pipeline, and
+// dispatches them to the handlers.
+func (c *watcherCore) handleEvents(source Backend, ets ...Event) {
 
-	if logHandler == nil {
-		logHandler = logger.NewNoop()
-	}
-	var wrapper = radovskybwatcherWatcherWrapper{
-		logHandler:   logHandler,
-		eventHook:    eventHook,
-		handlers:     fsEventHandlers,
-		watcher:      radovskybwatcher.New(),
-		watchGap:     watchGap,
-		errChanStart: make(chan error, 1),
-	}
-	go func(wrapper radovskybwatcherWatcherWrapper) {
-		for {
-			select {
-			case et, ok := <-wrapper.watcher.Event:
-				if !ok {
-					wrapper.logHandler.Warn("watcher event chan was closed")
-					return
-				}
-				var etWarpper = newRadovskybwatcherEventWrapper(et)
-				wrapper.logHandler.Info("event happen ", etWarpper.String())
-				if wrapper.eventHook != nil {
-					var isSkip = false
-					if etWarpper, isSkip = wrapper.eventHook(etWarpper); isSkip {
-						continue
-					}
-				}
-				eventTwoPartHandles(etWarpper, wrapper.handlers)
-			case err, ok := <-wrapper.watcher.Error:
-				if !ok {
-					wrapper.logHandler.Warn("watcher error chan was closed")
-					return
-				}
-				wrapper.logHandler.Error(err)
-			case <-wrapper.watcher.Closed:
-				wrapper.logHandler.Warn("watcher was closed")
-				return
+	c.handleMu.Lock()
+	defer c.handleMu.Unlock()
+
+	for _, et := range ets {
+		var isKept bool
+		if et, isKept = maskOp(et, c.ops); !isKept {
+			continue
+		}
+		et = stampEvent(et, time.Now(), c.seq.Add(1), source)
+		c.logHandler.Info("event happen ", et.String())
+		if c.eventHook != nil {
+			var isSkip = false
+			if et, isSkip = c.eventHook(et); isSkip {
+				continue
 			}
 		}
-	}(wrapper)
-	var funcStart = func(wrapper radovskybwatcherWatcherWrapper) {
-		// we should not use wrapper.watcher.Wait(), because it will cause this go routine leaks if wrapper.watcher.Start returns first before wrapper.watcher.Wait()
-		// wrapper.watcher.Wait(); wrapper.errChanStart <- nil
-		wrapper.errChanStart <- wrapper.watcher.Start(wrapper.watchGap)
-	}
-	// we run twice for checking whether watcher starts success
-	go funcStart(wrapper)
-	go funcStart(wrapper)
-	if err = <-wrapper.errChanStart; err != radovskybwatcher.ErrWatcherRunning {
-		wrapper.Close() // clear resource and started golang routine
-		err = errors.WithStack(err)
-		return
+		for _, out := range c.pipeline.Process(et) {
+			c.dispatcher.dispatch(out)
+		}
 	}
-	watcher, err = wrapper, nil
-	return
 }
 
-func eventTwoPartHandles(et Event, handles []FSEventHandler) {
+func (c *watcherCore) Pipeline() *Pipeline { return c.pipeline }
 
-	var l, h = 0, len(handles) - 1
-	for ; l < h; l, h = l+1, h-1 {
-		go handles[l].FSHandle(et)
-		go handles[h].FSHandle(et)
-	}
-	if l == h {
-		go handles[l].FSHandle(et)
+func (c *watcherCore) Subscribe(handler FSEventHandler, opts ...HandlerOption) (unsubscribe func()) {
+
+	var isSubscribed bool
+	if unsubscribe, isSubscribed = c.dispatcher.subscribe(handler, opts...); !isSubscribed {
+		c.logHandler.Warn("watcher was stopped, the handler is not subscribed")
 	}
+	return
 }
 
+func (c *watcherCore) SetErrorHandler(errorHandler ErrorHandlerFunc) { c.reporter.set(errorHandler) }
+
 func emptyFuncForTest() {}
@@ -1,11 +1,18 @@
 package watcher
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/xiaoyang-chen/file-watcher/logger"
+	radovskybwatcher "github.com/xiaoyang-chen/file-watcher/radovskyb-watcher"
 )
 
 func Test_emptyFuncForTest(t *testing.T) {
@@ -45,3 +52,656 @@ func Test_emptyFuncForTest(t *testing.T) {
 		})
 	}
 }
+
+type eventCollector struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (c *eventCollector) FSHandle(event Event) {
+	c.mu.Lock()
+	c.events = append(c.events, event)
+	c.mu.Unlock()
+}
+
+// waitFor waits until an event of path with op is collected or timeout.
+func (c *eventCollector) waitFor(path string, op Op, timeout time.Duration) bool {
+
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		c.mu.Lock()
+		for _, et := range c.events {
+			if et.Name() == path && et.Has(op) {
+				c.mu.Unlock()
+				return true
+			}
+		}
+		c.mu.Unlock()
+	}
+	return false
+}
+
+func TestFsnotifyWatcherAddRecursive(t *testing.T) {
+
+	var testDir = t.TempDir()
+	var sub = filepath.Join(testDir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	var collector = new(eventCollector)
+	var w, err = NewFsnotifyWatcher(nil, nil, collector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err = w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+	// write into an existing sub directory.
+	var file = filepath.Join(sub, "file.txt")
+	if err = os.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !collector.waitFor(file, Create, time.Second) {
+		t.Errorf("expected create event of %s", file)
+	}
+	// create a new directory tree, the paths below it must be reported too.
+	var newFile = filepath.Join(testDir, "new", "deep", "file.txt")
+	if err = os.MkdirAll(filepath.Dir(newFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(newFile, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !collector.waitFor(newFile, Create, time.Second) {
+		t.Errorf("expected create event of %s", newFile)
+	}
+	// the directory created later must be watched.
+	var laterFile = filepath.Join(testDir, "new", "deep", "later.txt")
+	time.Sleep(50 * time.Millisecond)
+	if err = os.WriteFile(laterFile, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !collector.waitFor(laterFile, Create, time.Second) {
+		t.Errorf("expected create event of %s", laterFile)
+	}
+}
+
+func TestFsnotifyWatcherAddRecursiveFile(t *testing.T) {
+
+	var file = filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var collector = new(eventCollector)
+	var w, err = NewFsnotifyWatcher(nil, nil, collector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err = w.AddRecursive(file); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(file, []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !collector.waitFor(file, Write, time.Second) {
+		t.Errorf("expected write event of %s", file)
+	}
+}
+
+func TestFsnotifyWatcherRemoveNestedRecursive(t *testing.T) {
+
+	var testDir = t.TempDir()
+	var sub = filepath.Join(testDir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	var collector = new(eventCollector)
+	var w, err = NewFsnotifyWatcher(nil, nil, collector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err = w.AddRecursive(testDir, sub); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.RemovePaths(sub); err != nil {
+		t.Fatal(err)
+	}
+	if list := w.WatchList(); len(list) != 1 || list[0] != testDir {
+		t.Fatalf("expected watch list to be [%s], got %v", testDir, list)
+	}
+	// the sub directory is still watched for the outer root.
+	var file = filepath.Join(sub, "new.txt")
+	if err = os.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !collector.waitFor(file, Create, time.Second) {
+		t.Errorf("expected create event of %s", file)
+	}
+}
+
+func TestFsnotifyWatcherRemoveOuterRecursive(t *testing.T) {
+
+	var testDir = t.TempDir()
+	var sub, other = filepath.Join(testDir, "sub"), filepath.Join(testDir, "other")
+	for _, dir := range []string{sub, other} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var collector = new(eventCollector)
+	var w, err = NewFsnotifyWatcher(nil, nil, collector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err = w.AddRecursive(testDir, sub); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.AddPaths(other); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.RemovePaths(testDir); err != nil {
+		t.Fatal(err)
+	}
+	if list := w.WatchList(); len(list) != 2 || list[0] != other || list[1] != sub {
+		t.Fatalf("expected watch list to be [%s %s], got %v", other, sub, list)
+	}
+	// the names below the removed root are still watched.
+	for _, dir := range []string{sub, other} {
+		var file = filepath.Join(dir, "new.txt")
+		if err = os.WriteFile(file, []byte("a"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if !collector.waitFor(file, Create, time.Second) {
+			t.Errorf("expected create event of %s", file)
+		}
+	}
+}
+
+func TestRemovePathsAndWatchList(t *testing.T) {
+
+	var testDir = t.TempDir()
+	var sub = filepath.Join(testDir, "sub")
+	var other = filepath.Join(testDir, "other")
+	for _, dir := range []string{sub, other} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fsnotifywatcher, err := NewFsnotifyWatcher(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsnotifywatcher.Close()
+	radovskybwatcher, err := NewRadovskybwatcherWatcher(nil, nil, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer radovskybwatcher.Close()
+	for name, w := range map[string]Watcher{"fsnotifywatcher": fsnotifywatcher, "radovskybwatcher": radovskybwatcher} {
+		t.Run(name, func(t *testing.T) {
+			if err := w.AddRecursive(testDir); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.AddPaths(other); err != nil {
+				t.Fatal(err)
+			}
+			var list = w.WatchList()
+			if len(list) != 2 || list[0] != testDir || list[1] != other {
+				t.Fatalf("expected watch list to be [%s %s], got %v", testDir, other, list)
+			}
+			if err := w.RemovePaths(other, filepath.Join(testDir, "not-watched")); err != nil {
+				t.Fatal(err)
+			}
+			if list = w.WatchList(); len(list) != 1 || list[0] != testDir {
+				t.Fatalf("expected watch list to be [%s], got %v", testDir, list)
+			}
+			if err := w.RemovePaths(testDir); err != nil {
+				t.Fatal(err)
+			}
+			if list = w.WatchList(); len(list) != 0 {
+				t.Fatalf("expected watch list to be empty, got %v", list)
+			}
+		})
+	}
+}
+
+func TestFsnotifyWatcherRenameAndMove(t *testing.T) {
+
+	var testDir = t.TempDir()
+	var sub = filepath.Join(testDir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	var src = filepath.Join(testDir, "src.txt")
+	if err := os.WriteFile(src, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var collector = new(eventCollector)
+	var w, err = NewFsnotifyWatcher(nil, nil, collector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err = w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+	var renamed = filepath.Join(testDir, "renamed.txt")
+	if err = os.Rename(src, renamed); err != nil {
+		t.Fatal(err)
+	}
+	if !collector.waitFor(renamed, Rename, time.Second) {
+		t.Fatalf("expected rename event of %s", renamed)
+	}
+	var moved = filepath.Join(sub, "moved.txt")
+	if err = os.Rename(renamed, moved); err != nil {
+		t.Fatal(err)
+	}
+	if !collector.waitFor(moved, Move, time.Second) {
+		t.Fatalf("expected move event of %s", moved)
+	}
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	for _, et := range collector.events {
+		switch {
+		case et.Name() == renamed && et.Has(Rename) && et.OldName() != src:
+			t.Errorf("expected old name of %s to be %s, got %s", renamed, src, et.OldName())
+		case et.Name() == moved && et.Has(Move) && et.OldName() != renamed:
+			t.Errorf("expected old name of %s to be %s, got %s", moved, renamed, et.OldName())
+		}
+	}
+}
+
+func TestFsnotifyWatcherRenameNotPairedWithOtherFile(t *testing.T) {
+
+	var testDir, outside = t.TempDir(), t.TempDir()
+	var src = filepath.Join(testDir, "a.txt")
+	if err := os.WriteFile(src, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var collector = new(eventCollector)
+	var w, err = NewFsnotifyWatcher(nil, nil, collector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err = w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+	// a path moved out of the tree and a file created right after it are not the same file.
+	if err = os.Rename(src, filepath.Join(outside, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	var unrelated = filepath.Join(testDir, "unrelated.txt")
+	if err = os.WriteFile(unrelated, []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !collector.waitFor(unrelated, Create, time.Second) {
+		t.Errorf("expected create event of %s", unrelated)
+	}
+	if !collector.waitFor(src, Rename, time.Second) {
+		t.Errorf("expected rename event of %s", src)
+	}
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	for _, et := range collector.events {
+		if et.OldName() != "" {
+			t.Errorf("expected no paired event, got %s from %s", et, et.OldName())
+		}
+	}
+}
+
+func TestRadovskybwatcherMoveEvent(t *testing.T) {
+
+	var et = newRadovskybwatcherEventWrapper(radovskybwatcher.Event{Op: radovskybwatcher.Move, Path: "/b/f", OldPath: "/a/f"})
+	if !et.Has(Move) || et.OldName() != "/a/f" {
+		t.Errorf("expected move event from /a/f, got op %s and old name %q", opString(et.Op()), et.OldName())
+	}
+	et = newRadovskybwatcherEventWrapper(radovskybwatcher.Event{Op: radovskybwatcher.Write, Path: "/a/f", OldPath: "/a/f"})
+	if et.OldName() != "" {
+		t.Errorf("expected old name of write event to be empty, got %q", et.OldName())
+	}
+	for op, expected := range map[Op]string{Move: "MOVE", Create | Move: "CREATE|MOVE", Write: "WRITE"} {
+		if opString(op) != expected {
+			t.Errorf("expected %s, got %s", expected, opString(op))
+		}
+	}
+}
+
+func TestEventMeta(t *testing.T) {
+
+	var testDir = t.TempDir()
+	var fsnotifyCollector, radovskybCollector = new(eventCollector), new(eventCollector)
+	fsnotifywatcher, err := NewFsnotifyWatcher(nil, nil, fsnotifyCollector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsnotifywatcher.Close()
+	radovskybwatcher, err := NewRadovskybwatcherWatcher(nil, nil, 10*time.Millisecond, radovskybCollector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer radovskybwatcher.Close()
+	for _, w := range []Watcher{fsnotifywatcher, radovskybwatcher} {
+		if err = w.AddPaths(testDir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var start = time.Now()
+	var file = filepath.Join(testDir, "file.txt")
+	if err = os.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for source, collector := range map[Backend]*eventCollector{BackendFsnotify: fsnotifyCollector, BackendRadovskybwatcher: radovskybCollector} {
+		if !collector.waitFor(file, Create, time.Second) {
+			t.Fatalf("%s: expected create event of %s", source, file)
+		}
+		collector.mu.Lock()
+		var lastSeq uint64
+		for _, et := range collector.events {
+			if et.Source() != source {
+				t.Errorf("expected source to be %s, got %s", source, et.Source())
+			}
+			if et.Seq() <= lastSeq {
+				t.Errorf("%s: expected seq to increase, got %d after %d", source, et.Seq(), lastSeq)
+			}
+			lastSeq = et.Seq()
+			if et.Time().Before(start) {
+				t.Errorf("%s: expected time after %s, got %s", source, start, et.Time())
+			}
+			if info := et.FileInfo(); et.Name() == file && (info == nil || info.Name() != "file.txt") {
+				t.Errorf("%s: expected file info of file.txt, got %v", source, info)
+			}
+		}
+		collector.mu.Unlock()
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+
+	if _, err := New("unknown"); !errors.Is(err, ErrUnknownBackend) {
+		t.Fatalf("expected ErrUnknownBackend, got %v", err)
+	}
+	var testDir = t.TempDir()
+	var fsnotifyCollector, radovskybCollector = new(eventCollector), new(eventCollector)
+	fsnotifywatcher, err := New(BackendFsnotify, WithHandlers(fsnotifyCollector), WithIgnoreHidden(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsnotifywatcher.Close()
+	radovskybwatcher, err := New(BackendRadovskybwatcher, WithHandlers(radovskybCollector), WithIgnoreHidden(true),
+		WithPollInterval(10*time.Millisecond), WithOps(Create))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer radovskybwatcher.Close()
+	for _, w := range []Watcher{fsnotifywatcher, radovskybwatcher} {
+		if err = w.AddPaths(testDir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{".hidden", "file.txt"} {
+		if err = os.WriteFile(filepath.Join(testDir, name), []byte("a"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var file = filepath.Join(testDir, "file.txt")
+	for _, collector := range []*eventCollector{fsnotifyCollector, radovskybCollector} {
+		if !collector.waitFor(file, Create, time.Second) {
+			t.Fatalf("expected create event of %s", file)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	for _, collector := range []*eventCollector{fsnotifyCollector, radovskybCollector} {
+		collector.mu.Lock()
+		for _, et := range collector.events {
+			if filepath.Base(et.Name()) == ".hidden" {
+				t.Errorf("expected hidden file to be ignored, got %s", et)
+			}
+			if et.Source() == BackendRadovskybwatcher && et.Op() != Create {
+				t.Errorf("expected only create events, got %s", et)
+			}
+		}
+		collector.mu.Unlock()
+	}
+}
+
+func TestHybridWatcherFallback(t *testing.T) {
+
+	var testDir = t.TempDir()
+	var local, remote = filepath.Join(testDir, "local"), filepath.Join(testDir, "remote")
+	for _, dir := range []string{local, remote} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func(detect func(path string) (string, bool)) { detectUnreliableFS = detect }(detectUnreliableFS)
+	detectUnreliableFS = func(path string) (string, bool) { return "nfs", path == remote }
+	var collector = new(eventCollector)
+	var w, err = New(BackendHybrid, WithPollInterval(10*time.Millisecond), WithHandlers(collector))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err = w.AddRecursive(local, remote); err != nil {
+		t.Fatal(err)
+	}
+	if list := w.WatchList(); len(list) != 2 || list[0] != local || list[1] != remote {
+		t.Errorf("expected watch list of %s and %s, got %v", local, remote, list)
+	}
+	var expected = map[string]Backend{filepath.Join(local, "a.txt"): BackendFsnotify, filepath.Join(remote, "b.txt"): BackendRadovskybwatcher}
+	for file := range expected {
+		if err = os.WriteFile(file, []byte("a"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for file, backend := range expected {
+		if !collector.waitFor(file, Create, time.Second) {
+			t.Fatalf("expected create event of %s", file)
+		}
+		collector.mu.Lock()
+		for _, et := range collector.events {
+			if et.Name() == file && et.Source() != backend {
+				t.Errorf("expected source of %s to be %s, got %s", file, backend, et.Source())
+			}
+		}
+		collector.mu.Unlock()
+	}
+	// a path fsnotify fails to watch is not watched by polling either if it does not exist.
+	if err = w.AddPaths(filepath.Join(testDir, "missing")); err == nil {
+		t.Error("expected error of a missing path")
+	}
+	if err = w.RemovePaths(remote); err != nil {
+		t.Fatal(err)
+	}
+	if list := w.WatchList(); len(list) != 1 || list[0] != local {
+		t.Errorf("expected watch list of %s, got %v", local, list)
+	}
+}
+
+func TestRadovskybwatcherSnapshot(t *testing.T) {
+
+	var testDir, snapshotPath = t.TempDir(), filepath.Join(t.TempDir(), "snapshot.json")
+	var w, err = New(BackendRadovskybwatcher, WithPollInterval(10*time.Millisecond), WithSnapshot(snapshotPath, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.AddPaths(testDir); err != nil {
+		t.Fatal(err)
+	}
+	// the snapshot is saved by Close.
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var file = filepath.Join(testDir, "file.txt")
+	if err = os.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var collector = new(eventCollector)
+	if w, err = New(BackendRadovskybwatcher, WithPollInterval(10*time.Millisecond), WithSnapshot(snapshotPath, 0),
+		WithHandlers(collector)); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err = w.AddPaths(testDir); err != nil {
+		t.Fatal(err)
+	}
+	if !collector.waitFor(file, Create, time.Second) {
+		t.Errorf("expected create event of %s made while the watcher was closed", file)
+	}
+}
+
+func TestRadovskybwatcherSnapshotSavedPeriodically(t *testing.T) {
+
+	var testDir, snapshotPath = t.TempDir(), filepath.Join(t.TempDir(), "snapshot.json")
+	// a periodic save must not replace the snapshot saved by Close by an empty one.
+	for i := 0; i < 20; i++ {
+		var w, err = New(BackendRadovskybwatcher, WithPollInterval(time.Millisecond),
+			WithSnapshot(snapshotPath, time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = w.AddPaths(testDir); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+		var data []byte
+		if data, err = os.ReadFile(snapshotPath); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(data, []byte(testDir)) {
+			t.Fatalf("expected the snapshot to have %s, got %s", testDir, data)
+		}
+	}
+}
+
+func TestRadovskybwatcherContentHash(t *testing.T) {
+
+	var testDir = t.TempDir()
+	var collector = new(eventCollector)
+	var w, err = New(BackendRadovskybwatcher, WithPollInterval(10*time.Millisecond), WithContentHash(sha256.New, 0, false),
+		WithHandlers(collector))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err = w.AddPaths(testDir); err != nil {
+		t.Fatal(err)
+	}
+	var file = filepath.Join(testDir, "file.txt")
+	if err = os.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !collector.waitFor(file, Write, time.Second) {
+		t.Fatalf("expected write event of %s", file)
+	}
+	var sum = sha256.Sum256([]byte("a"))
+	var last Event
+	collector.mu.Lock()
+	for _, et := range collector.events {
+		if et.Name() == file && et.Has(Write) {
+			last = et
+		}
+	}
+	collector.mu.Unlock()
+	if !bytes.Equal(ContentHash(last), sum[:]) {
+		t.Errorf("expected content hash %x of %s, got %x", sum, last, ContentHash(last))
+	}
+}
+
+func TestRadovskybwatcherIncrementalScan(t *testing.T) {
+
+	var testDir = t.TempDir()
+	writeTree(t, testDir, map[string]string{"a/1.txt": "a", "a/2.txt": "a", "b/3.txt": "a"})
+	var w, err = New(BackendRadovskybwatcher, WithPollInterval(10*time.Millisecond), WithIncrementalScan(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err = w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	var reporter, ok = w.(ScanStatsReporter)
+	if !ok {
+		t.Fatal("expected the polling watcher to report scan stats")
+	}
+	if stats := reporter.ScanStats(); stats.FullScans != 1 || stats.StatsSaved == 0 {
+		t.Errorf("expected 1 full scan and stats saved, got %+v", stats)
+	}
+}
+
+func TestRadovskybwatcherAdaptivePollInterval(t *testing.T) {
+
+	var testDir = t.TempDir()
+	var collector = new(eventCollector)
+	var w, err = New(BackendRadovskybwatcher, WithAdaptivePollInterval(10*time.Millisecond, time.Hour, 0.5),
+		WithHandlers(collector))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.AddPaths(testDir); err != nil {
+		t.Fatal(err)
+	}
+	// the idle scans back off from 10ms, so the change is found by a longer sleep.
+	time.Sleep(100 * time.Millisecond)
+	var file = filepath.Join(testDir, "file.txt")
+	if err = os.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !collector.waitFor(file, Create, time.Second) {
+		t.Errorf("expected create event of %s", file)
+	}
+	// Close ends the sleep of the backoff.
+	var closed = make(chan struct{})
+	go func() {
+		w.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("expected Close not to wait for the sleep")
+	}
+}
+
+func TestRadovskybwatcherAddWithInterval(t *testing.T) {
+
+	var hotDir, archiveDir = t.TempDir(), t.TempDir()
+	var collector = new(eventCollector)
+	var w, err = New(BackendRadovskybwatcher, WithPollInterval(time.Hour), WithHandlers(collector))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	var iw, ok = w.(IntervalWatcher)
+	if !ok {
+		t.Fatal("expected the polling watcher to add paths with intervals")
+	}
+	if err = iw.AddWithInterval(20*time.Millisecond, hotDir); err != nil {
+		t.Fatal(err)
+	}
+	if err = iw.AddRecursiveWithInterval(time.Hour, archiveDir); err != nil {
+		t.Fatal(err)
+	}
+	var hot, archived = filepath.Join(hotDir, "config.yaml"), filepath.Join(archiveDir, "archive.tar")
+	if err = os.WriteFile(archived, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(hot, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the hot path is scanned by its interval although the poll interval is an hour.
+	if !collector.waitFor(hot, Create, time.Second) {
+		t.Errorf("expected create event of %s", hot)
+	}
+	if collector.waitFor(archived, Create, 100*time.Millisecond) {
+		t.Errorf("expected no event of %s before its interval", archived)
+	}
+}